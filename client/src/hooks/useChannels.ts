@@ -15,7 +15,6 @@ export interface Channel {
   is_member: boolean
   is_admin: boolean
   member_count: number
-  members: Members[]
   created_at: string
 }
 
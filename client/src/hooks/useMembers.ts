@@ -0,0 +1,47 @@
+import { channelApi } from "@/lib/api"
+import { useInfiniteQuery } from "@tanstack/react-query"
+
+export interface ChannelMember {
+  id: string
+  username: string
+  role: "owner" | "moderator" | "member" | "read_only"
+  is_online: boolean
+  presence: string
+  last_online: string
+  joined_at: string
+}
+
+interface MembersPage {
+  members: ChannelMember[]
+  total: number
+  has_more: boolean
+}
+
+const PAGE_SIZE = 50
+
+export const useMembers = (channelId: string, enabled = true) => {
+  const {
+    data,
+    isLoading: membersLoading,
+    fetchNextPage,
+    hasNextPage,
+    isFetchingNextPage,
+  } = useInfiniteQuery<MembersPage>({
+    queryKey: ["members", channelId],
+    queryFn: ({ pageParam }) => channelApi.getMembers(channelId, pageParam as number, PAGE_SIZE),
+    initialPageParam: 0,
+    getNextPageParam: (lastPage, pages) =>
+      lastPage.has_more ? pages.reduce((n, page) => n + page.members.length, 0) : undefined,
+    enabled: enabled && !!channelId,
+    staleTime: 1000 * 30,
+  })
+
+  return {
+    members: data?.pages.flatMap(page => page.members) ?? [],
+    total: data?.pages[0]?.total ?? 0,
+    membersLoading,
+    hasMoreMembers: !!hasNextPage,
+    loadMoreMembers: fetchNextPage,
+    loadingMoreMembers: isFetchingNextPage,
+  }
+}
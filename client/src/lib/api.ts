@@ -48,6 +48,10 @@ export const channelApi = {
     const { data } = await api.patch(`channels/${id}/change-name/${name}`)
     return data
   },
+  getMembers: async (id: string, offset = 0, limit = 50) => {
+    const { data } = await api.get(`/channels/${id}/member`, { params: { offset, limit } });
+    return data.data;
+  },
 };
 
 export const userApi = {
@@ -1,4 +1,5 @@
 import { useChannels } from '@/hooks/useChannels'
+import { useMembers } from '@/hooks/useMembers'
 import { createFileRoute, useNavigate } from '@tanstack/react-router'
 import { Hash, Loader2, RotateCwIcon, Settings, Users, X } from 'lucide-react'
 import { Skeleton } from "@/components/ui/skeleton"
@@ -34,7 +35,7 @@ function RouteComponent() {
   const [showMembers, setShowMembers] = useState(false)
   const [accessType, setAccessType] = useState<string>(channel?.access_type ?? 'public')
   const [newName, setNewName] = useState(channel?.name ?? "")
-  const members = channel?.members ?? []
+  const { members, membersLoading, hasMoreMembers, loadMoreMembers, loadingMoreMembers } = useMembers(id, showMembers)
 
   const handleAccessType = () => {
     if (accessType == channel?.access_type) {
@@ -191,11 +192,11 @@ function RouteComponent() {
 
           <div className="flex-1 overflow-y-auto p-2">
             <div className="space-y-1">
-              {channelLoading ? (
+              {membersLoading ? (
                 <p className="text-sm text-muted-foreground">Loading...</p>
               ) : (
                 members.map(member => {
-                  const isAdmin = member.id === channel.admin.id
+                  const isAdmin = member.role === "owner"
                   return (
                     <div
                       key={member.id}
@@ -221,6 +222,16 @@ function RouteComponent() {
                 })
               )}
             </div>
+            {hasMoreMembers && (
+              <Button
+                variant="ghost"
+                className="w-full mt-2 text-sm"
+                onClick={() => loadMoreMembers()}
+                disabled={loadingMoreMembers}
+              >
+                {loadingMoreMembers ? <Loader2 className="animate-spin h-4 w-4" /> : "Load more"}
+              </Button>
+            )}
           </div>
         </div>
       )}
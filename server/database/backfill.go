@@ -0,0 +1,18 @@
+package database
+
+import (
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/models"
+)
+
+// BackfillEmailVerified marks every account created before cutoff as
+// verified. users.email_verified was added with a default of false, which
+// under the default no_posting policy would stop all existing accounts from
+// posting. Running it again with the same cutoff changes nothing.
+func BackfillEmailVerified(cutoff time.Time) (int64, error) {
+	result := DB.Model(&models.User{}).
+		Where("email_verified = ? AND created_at < ?", false, cutoff).
+		Update("email_verified", true)
+	return result.RowsAffected, result.Error
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"github.com/RudraPatel5435/vyenet/server/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
@@ -22,6 +23,11 @@ func ConnectDB() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// channel_members carries a role column, so gorm needs the custom join model
+	if err := db.SetupJoinTable(&models.Channel{}, "Members", &models.ChannelMember{}); err != nil {
+		log.Fatalf("Failed to set up channel_members join table: %v", err)
+	}
+
 	fmt.Println("Connected to database succesfully")
 	DB = db
 }
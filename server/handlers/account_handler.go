@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/mailer"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const passwordResetTTL = time.Hour
+
+var (
+	errTokenInvalid = errors.New("This link is invalid or has already been used")
+	errTokenExpired = errors.New("This link has expired")
+)
+
+var accountMailer mailer.Mailer
+
+// SetMailer installs the mailer used for account emails
+func SetMailer(m mailer.Mailer) {
+	accountMailer = m
+}
+
+// sendMail delivers in the background so response times don't reveal whether
+// an address belongs to an account
+func sendMail(msg mailer.Message) {
+	if accountMailer == nil {
+		log.Printf("No mailer configured, dropping %q to %s", msg.Subject, msg.To)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := accountMailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// appLink builds a link into the web client, which is served from APP_URL
+func appLink(path, token string) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimRight(base, "/"), path, url.QueryEscape(token))
+}
+
+// issueUserToken replaces any outstanding token of the same purpose with a
+// fresh one and returns its plaintext, which only ever exists in the email
+func issueUserToken(tx *gorm.DB, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Delete(&models.UserToken{}).Error; err != nil {
+		return "", err
+	}
+
+	record := models.UserToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeUserToken marks a token used inside tx and returns it. The row lock
+// makes sure two requests can't both redeem the same token.
+func consumeUserToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	var record models.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&record, "token_hash = ? AND purpose = ? AND used_at IS NULL", utils.HashToken(token), purpose).Error; err != nil {
+		return nil, errTokenInvalid
+	}
+
+	if record.IsExpired() {
+		return nil, errTokenExpired
+	}
+
+	now := time.Now()
+	if err := tx.Model(&record).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	// Same answer whether or not the account exists
+	const sent = "If that email is registered, a reset link has been sent"
+
+	var user models.User
+	if err := database.DB.Where("email = ?", utils.SanitizeEmail(input.Email)).First(&user).Error; err != nil {
+		utils.SuccessResponse(c, 200, sent, nil)
+		return
+	}
+
+	token, err := issueUserToken(database.DB, user.ID, models.TokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to start password reset")
+		return
+	}
+
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Vyenet password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your Vyenet account. "+
+			"If it was you, open this link within the next hour:\n\n%s\n\n"+
+			"If it wasn't, you can ignore this email; your password won't change.\n",
+			user.Username, appLink("/reset-password", token)),
+	})
+
+	utils.SuccessResponse(c, 200, sent, nil)
+}
+
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := utils.ValidatePassword(input.Password); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to process password")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		record, err := consumeUserToken(tx, input.Token, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+
+		// Whoever knew the old password may hold a session or an API token;
+		// neither survives the reset
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", record.UserID).
+			Updates(map[string]any{
+				"password":        hashedPassword,
+				"session_version": gorm.Expr("session_version + 1"),
+			}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.APIToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", record.UserID).
+			Update("revoked_at", time.Now()).Error
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errTokenInvalid), errors.Is(err, errTokenExpired):
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to reset password")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Password has been reset, you can now log in", nil)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	apiTokenPrefix        = "vyn_"
+	apiTokenDefaultDays   = 30
+	apiTokenMaxDays       = 365
+	maxActiveAPITokens    = 25
+	apiTokenDisplayLength = len(apiTokenPrefix) + 8
+	maxAPITokenNameLength = 100
+)
+
+func apiTokenResponse(token models.APIToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"prefix":       token.Prefix,
+		"scopes":       token.ScopeList(),
+		"expires_at":   token.ExpiresAt,
+		"last_used_at": token.LastUsedAt,
+		"created_at":   token.CreatedAt,
+	}
+}
+
+func CreateAPIToken(c *gin.Context) {
+	var input struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Name) > maxAPITokenNameLength {
+		utils.ErrorResponse(c, 400, "Token name must be between 1 and 100 characters")
+		return
+	}
+
+	var scopes []string
+	for _, scope := range input.Scopes {
+		if scope != models.ScopeRead && scope != models.ScopeWrite {
+			utils.ErrorResponse(c, 400, "Scopes must be read or write")
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		utils.ErrorResponse(c, 400, "At least one scope is required")
+		return
+	}
+	slices.Sort(scopes)
+
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = apiTokenDefaultDays
+	}
+	if input.ExpiresInDays < 1 || input.ExpiresInDays > apiTokenMaxDays {
+		utils.ErrorResponse(c, 400, "expires_in_days must be between 1 and 365")
+		return
+	}
+
+	var active int64
+	if err := database.DB.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Count(&active).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to create token")
+		return
+	}
+	if active >= maxActiveAPITokens {
+		utils.ErrorResponse(c, 400, "You have too many active tokens, revoke one first")
+		return
+	}
+
+	secret, err := utils.GenerateToken(32)
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to create token")
+		return
+	}
+	plaintext := apiTokenPrefix + secret
+
+	token := models.APIToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Name:      input.Name,
+		Prefix:    plaintext[:apiTokenDisplayLength],
+		TokenHash: utils.HashToken(plaintext),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: time.Now().AddDate(0, 0, input.ExpiresInDays),
+	}
+
+	if err := database.DB.Create(&token).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to create token")
+		return
+	}
+
+	// The plaintext is only ever shown here
+	response := apiTokenResponse(token)
+	response["token"] = plaintext
+
+	utils.SuccessResponse(c, 201, "Token created, copy it now as it won't be shown again", response)
+}
+
+func ListAPITokens(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var tokens []models.APIToken
+	if err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch tokens")
+		return
+	}
+
+	response := []gin.H{}
+	for _, token := range tokens {
+		response = append(response, apiTokenResponse(token))
+	}
+
+	utils.SuccessResponse(c, 200, "Tokens fetched successfully", response)
+}
+
+func RevokeAPIToken(c *gin.Context) {
+	tokenID := c.Param("tokenId")
+	if !utils.IsValidUUID(tokenID) {
+		utils.ErrorResponse(c, 400, "Invalid token ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	result := database.DB.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, user.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		utils.ErrorResponse(c, 500, "Failed to revoke token")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.ErrorResponse(c, 404, "Token not found")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Token revoked", nil)
+}
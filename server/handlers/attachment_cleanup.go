@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// Uploads that were never sent with a message are dropped after this long
+	unsentAttachmentTTL = 24 * time.Hour
+	attachmentSweepSize = 200
+)
+
+// StartAttachmentJanitor periodically removes the files of deleted attachments,
+// of attachments whose message was deleted, and of uploads never sent
+func StartAttachmentJanitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sweepAttachments()
+			<-ticker.C
+		}
+	}()
+}
+
+func sweepAttachments() {
+	var attachments []models.Attachment
+	err := database.DB.Unscoped().
+		Joins("LEFT JOIN messages ON messages.id = attachments.message_id").
+		Where("attachments.deleted_at IS NOT NULL").
+		Or("attachments.message_id IS NULL AND attachments.created_at < ?", time.Now().Add(-unsentAttachmentTTL)).
+		Or("messages.deleted_at IS NOT NULL").
+		Limit(attachmentSweepSize).
+		Find(&attachments).Error
+	if err != nil {
+		log.Printf("Failed to find attachments to clean up: %v", err)
+		return
+	}
+
+	purgeAttachments(attachments)
+}
+
+// purgeAttachments deletes stored files and then their rows. A row whose file
+// couldn't be removed stays behind for the next sweep to retry.
+func purgeAttachments(attachments []models.Attachment) {
+	if fileStore == nil || len(attachments) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	removed := make([]uuid.UUID, 0, len(attachments))
+	for _, attachment := range attachments {
+		if err := fileStore.Delete(ctx, attachment.StorageKey); err != nil {
+			log.Printf("Failed to delete attachment %s: %v", attachment.ID, err)
+			continue
+		}
+		removed = append(removed, attachment.ID)
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+	if err := database.DB.Unscoped().Where("id IN ?", removed).Delete(&models.Attachment{}).Error; err != nil {
+		log.Printf("Failed to delete attachment rows: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/storage"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxAttachmentSize        = 25 << 20
+	maxAttachmentsPerMessage = 10
+	maxFilenameLen           = 255
+)
+
+// Only these are rendered by the browser; everything else is served as a
+// download so an uploaded HTML or SVG file can't run script on our origin
+var inlineContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	errAttachmentInvalid  = errors.New("One or more attachments are invalid or already sent")
+	errTooManyAttachments = fmt.Errorf("A message can have at most %d attachments", maxAttachmentsPerMessage)
+)
+
+var fileStore storage.Storage
+
+// SetStorage installs the backend uploaded files are kept in
+func SetStorage(s storage.Storage) {
+	fileStore = s
+}
+
+func attachmentResponse(attachment models.Attachment) gin.H {
+	return gin.H{
+		"id":           attachment.ID,
+		"filename":     attachment.Filename,
+		"content_type": attachment.ContentType,
+		"size":         attachment.Size,
+		"url":          fmt.Sprintf("/api/channels/%s/attachments/%s", attachment.ChannelID, attachment.ID),
+		"created_at":   attachment.CreatedAt,
+	}
+}
+
+func attachmentsResponse(attachments []models.Attachment) []gin.H {
+	response := []gin.H{}
+	for _, attachment := range attachments {
+		response = append(response, attachmentResponse(attachment))
+	}
+	return response
+}
+
+// cleanFilename keeps only the base name the client sent, trimmed to fit the column
+func cleanFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	for len(name) > maxFilenameLen {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// resolveAttachments checks that ids are the user's own unsent uploads in
+// channelID; saveMessage links them to the message
+func resolveAttachments(channelID, userID uuid.UUID, ids []string) ([]models.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if len(ids) > maxAttachmentsPerMessage {
+		return nil, errTooManyAttachments
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !utils.IsValidUUID(id) || seen[id] {
+			return nil, errAttachmentInvalid
+		}
+		seen[id] = true
+	}
+
+	var attachments []models.Attachment
+	if err := database.DB.
+		Where("id IN ? AND channel_id = ? AND uploader_id = ? AND message_id IS NULL", ids, channelID, userID).
+		Order("created_at ASC").
+		Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+
+	if len(attachments) != len(ids) {
+		return nil, errAttachmentInvalid
+	}
+
+	return attachments, nil
+}
+
+// linkAttachments claims the message's attachments inside saveMessage's
+// transaction, failing if another message got to any of them first
+func linkAttachments(tx *gorm.DB, message *models.Message) error {
+	if len(message.Attachments) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(message.Attachments))
+	for i := range message.Attachments {
+		ids = append(ids, message.Attachments[i].ID)
+		message.Attachments[i].MessageID = &message.ID
+	}
+
+	result := tx.Model(&models.Attachment{}).
+		Where("id IN ? AND message_id IS NULL", ids).
+		Update("message_id", message.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(ids)) {
+		return errAttachmentInvalid
+	}
+	return nil
+}
+
+func UploadAttachment(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	if !middleware.CanPost(user) {
+		utils.ErrorResponse(c, 403, errEmailUnverified.Error())
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	role := memberRole(&channel, user.ID)
+	if role == "" {
+		utils.ErrorResponse(c, 403, "You must be a member to upload files in this channel")
+		return
+	}
+
+	if !models.RoleHasPermission(role, models.PermSendMessages) {
+		utils.ErrorResponse(c, 403, "You don't have permission to upload files in this channel")
+		return
+	}
+
+	// Leave headroom for the multipart framing around the file itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentSize+(1<<20))
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, 413, "File must be smaller than 25MB")
+			return
+		}
+		utils.ErrorResponse(c, 400, "File is required")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAttachmentSize {
+		utils.ErrorResponse(c, 413, "File must be smaller than 25MB")
+		return
+	}
+
+	if header.Size == 0 {
+		utils.ErrorResponse(c, 400, "File is empty")
+		return
+	}
+
+	// Trust the bytes, not the client's Content-Type header
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		utils.ErrorResponse(c, 400, "Failed to read file")
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		utils.ErrorResponse(c, 500, "Failed to read file")
+		return
+	}
+
+	attachment := models.Attachment{
+		ID:          uuid.New(),
+		ChannelID:   channel.ID,
+		UploaderID:  user.ID,
+		Filename:    cleanFilename(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+	}
+	attachment.StorageKey = fmt.Sprintf("%s/%s", channel.ID, attachment.ID)
+
+	if err := fileStore.Put(c.Request.Context(), attachment.StorageKey, file, attachment.Size, contentType); err != nil {
+		log.Printf("Failed to store attachment: %v", err)
+		utils.ErrorResponse(c, 500, "Failed to upload file")
+		return
+	}
+
+	if err := database.DB.Create(&attachment).Error; err != nil {
+		fileStore.Delete(c.Request.Context(), attachment.StorageKey)
+		utils.ErrorResponse(c, 500, "Failed to upload file")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, "File uploaded successfully", attachmentResponse(attachment))
+}
+
+func DownloadAttachment(c *gin.Context) {
+	channelID := c.Param("id")
+	attachmentID := c.Param("attachmentId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(attachmentID) {
+		utils.ErrorResponse(c, 400, "Invalid attachment ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if channel.IsMembersOnly() && memberRole(&channel, user.ID) == "" {
+		utils.ErrorResponse(c, 403, "You don't have access to this private channel")
+		return
+	}
+
+	// Files stop being served as soon as their message is deleted, even
+	// before the janitor gets round to removing them
+	var attachment models.Attachment
+	if err := database.DB.
+		Joins("LEFT JOIN messages ON messages.id = attachments.message_id").
+		Where("attachments.id = ? AND attachments.channel_id = ?", attachmentID, channel.ID).
+		Where("attachments.message_id IS NULL OR messages.deleted_at IS NULL").
+		First(&attachment).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Attachment not found")
+		return
+	}
+
+	// Unsent uploads are only visible to whoever uploaded them
+	if attachment.MessageID == nil && attachment.UploaderID != user.ID {
+		utils.ErrorResponse(c, 404, "Attachment not found")
+		return
+	}
+
+	body, err := fileStore.Get(c.Request.Context(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			utils.ErrorResponse(c, 404, "Attachment not found")
+			return
+		}
+		log.Printf("Failed to read attachment: %v", err)
+		utils.ErrorResponse(c, 500, "Failed to download file")
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if inlineContentTypes[attachment.ContentType] {
+		disposition = "inline"
+	}
+
+	c.DataFromReader(200, attachment.Size, attachment.ContentType, body, map[string]string{
+		"Content-Disposition":     mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}),
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; sandbox",
+		"Cache-Control":           "private, max-age=3600",
+	})
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"errors"
+	"time"
+
 	"github.com/RudraPatel5435/vyenet/server/database"
 	"github.com/RudraPatel5435/vyenet/server/middleware"
 	"github.com/RudraPatel5435/vyenet/server/models"
 	"github.com/RudraPatel5435/vyenet/server/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+var errOwnershipChanged = errors.New("Channel ownership changed while transferring, please refresh and try again")
+
 func CreateChannel(c *gin.Context) {
 	var input struct {
 		Name       string `json:"name" binding:"required"`
@@ -48,6 +54,13 @@ func CreateChannel(c *gin.Context) {
 		return
 	}
 
+	if err := database.DB.Model(&models.ChannelMember{}).
+		Where("channel_id = ? AND user_id = ?", channel.ID, user.ID).
+		Update("role", models.RoleOwner).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to assign channel owner")
+		return
+	}
+
 	if err := database.DB.Model(&user).Association("OwnedChannels").Append(channel); err != nil {
 		utils.ErrorResponse(c, 500, "Failed to associate user to channel")
 	}
@@ -57,6 +70,7 @@ func CreateChannel(c *gin.Context) {
 		"name":        channel.Name,
 		"access_type": channel.AccessType,
 		"admin_id":    channel.AdminID,
+		"role":        models.RoleOwner,
 		"created_at":  channel.CreatedAt,
 	})
 }
@@ -74,13 +88,13 @@ func GetChannels(c *gin.Context) {
 		Select("DISTINCT channels.id").
 		Joins("LEFT JOIN channel_members ON channel_members.channel_id = channels.id").
 		Where("channels.access_type = ? OR channel_members.user_id = ?", "public", user.ID).
+		Where("channels.access_type <> ?", "direct").
 		Pluck("id", &channelIDs)
 
 	var channels []models.Channel
 
 	err := database.DB.
 		Preload("Admin").
-		Preload("Members").
 		Where("id IN ?", channelIDs).
 		Find(&channels).Error
 
@@ -89,19 +103,24 @@ func GetChannels(c *gin.Context) {
 		return
 	}
 
+	var memberships []models.ChannelMember
+	database.DB.Where("user_id = ? AND channel_id IN ?", user.ID, channelIDs).Find(&memberships)
+
+	roles := make(map[uuid.UUID]string)
+	for _, membership := range memberships {
+		roles[membership.ChannelID] = membership.Role
+	}
+
+	memberCounts := countChannelMembers(channelIDs)
+	unread := unreadCounts(user, channelIDs)
+
 	var response []gin.H
 	for _, channel := range channels {
-		isMember := false
-
-		var members []gin.H
-		for _, member := range channel.Members {
-			if member.ID == user.ID {
-				isMember = true
-			}
-			members = append(members, gin.H{
-				"id":       member.ID,
-				"username": member.Username,
-			})
+		_, isMember := roles[channel.ID]
+
+		role := roles[channel.ID]
+		if channel.AdminID == user.ID {
+			role = models.RoleOwner
 		}
 
 		response = append(response, gin.H{
@@ -112,11 +131,13 @@ func GetChannels(c *gin.Context) {
 				"id":       channel.AdminID,
 				"username": channel.Admin.Username,
 			},
-			"is_member":    isMember,
-			"is_admin":     channel.AdminID == user.ID,
-			"member_count": len(channel.Members),
-			"members":      members,
-			"created_at":   channel.CreatedAt,
+			"is_member":     isMember,
+			"is_admin":      channel.AdminID == user.ID,
+			"role":          role,
+			"member_count":  memberCounts[channel.ID],
+			"unread_count":  unread[channel.ID].Unread,
+			"mention_count": unread[channel.ID].Mentions,
+			"created_at":    channel.CreatedAt,
 		})
 	}
 
@@ -141,7 +162,6 @@ func GetChannel(c *gin.Context) {
 	var channel models.Channel
 	err := database.DB.
 		Preload("Admin").
-		Preload("Members").
 		First(&channel, "id = ?", channelID).Error
 
 	if err != nil {
@@ -149,27 +169,10 @@ func GetChannel(c *gin.Context) {
 		return
 	}
 
-	if channel.AccessType == "private" {
-		isMember := false
-		for _, member := range channel.Members {
-			if member.ID == user.ID {
-				isMember = true
-				break
-			}
-		}
-
-		if !isMember && channel.AdminID != user.ID {
-			utils.ErrorResponse(c, 403, "You don't have access to this channel")
-			return
-		}
-	}
-
-	var members []gin.H
-	for _, member := range channel.Members {
-		members = append(members, gin.H{
-			"id":       member.ID,
-			"username": member.Username,
-		})
+	role := memberRole(&channel, user.ID)
+	if channel.IsMembersOnly() && role == "" {
+		utils.ErrorResponse(c, 403, "You don't have access to this channel")
+		return
 	}
 
 	utils.SuccessResponse(c, 200, "Channel details fetched", gin.H{
@@ -180,9 +183,10 @@ func GetChannel(c *gin.Context) {
 			"id":       channel.Admin.ID,
 			"username": channel.Admin.Username,
 		},
-		"members":      members,
-		"member_count": len(members),
+		"member_count": countChannelMembers([]uuid.UUID{channel.ID})[channel.ID],
+		"is_member":    role != "",
 		"is_admin":     channel.AdminID == user.ID,
+		"role":         role,
 		"created_at":   channel.CreatedAt,
 	})
 }
@@ -207,8 +211,8 @@ func DeleteChannel(c *gin.Context) {
 		return
 	}
 
-	if channel.AdminID != user.ID {
-		utils.ErrorResponse(c, 403, "Only channel admin can delete channel")
+	if !hasChannelPermission(&channel, user.ID, models.PermDeleteChannel) {
+		utils.ErrorResponse(c, 403, "Only channel owner can delete channel")
 		return
 	}
 
@@ -247,9 +251,14 @@ func JoinChannel(c *gin.Context) {
 		}
 	}
 
+	if channel.IsDirect() {
+		utils.ErrorResponse(c, 403, "Direct messages can't be joined")
+		return
+	}
+
 	// Only public channels can be joined freely
 	if channel.AccessType == "private" {
-		utils.ErrorResponse(c, 403, "Cannot join private channel without invitation")
+		utils.ErrorResponse(c, 403, "Cannot join private channel without invitation. Redeem an invite code instead")
 		return
 	}
 
@@ -259,6 +268,8 @@ func JoinChannel(c *gin.Context) {
 		return
 	}
 
+	grantChannelMembership(channel.ID, user.ID)
+
 	utils.SuccessResponse(c, 200, "Successfully joined channel", gin.H{
 		"channel_id":   channel.ID,
 		"channel_name": channel.Name,
@@ -285,8 +296,13 @@ func LeaveChannel(c *gin.Context) {
 		return
 	}
 
+	if channel.IsDirect() {
+		utils.ErrorResponse(c, 403, "You can't leave a direct message")
+		return
+	}
+
 	if channel.AdminID == user.ID {
-		utils.ErrorResponse(c, 403, "Channel admin cannot leave. Delete the channel instead")
+		utils.ErrorResponse(c, 403, "Channel owner cannot leave. Transfer ownership or delete the channel instead")
 		return
 	}
 
@@ -310,6 +326,8 @@ func LeaveChannel(c *gin.Context) {
 		return
 	}
 
+	revokeChannelAccess(channel.ID, user.ID)
+
 	utils.SuccessResponse(c, 200, "Successfully left channel", gin.H{
 		"channel_id": channel.ID,
 	})
@@ -341,16 +359,22 @@ func ChangeAccessType(c *gin.Context) {
 		return
 	}
 
-	if channel.AdminID != user.ID {
-		utils.ErrorResponse(c, 403, "Channel settings can't be changed by members")
+	if !hasChannelPermission(&channel, user.ID, models.PermChangeAccess) {
+		utils.ErrorResponse(c, 403, "Only channel owner can change access type")
 		return
 	}
 
+	wasMembersOnly := channel.IsMembersOnly()
+
 	if err := database.DB.Model(&channel).Update("access_type", access_type).Error; err != nil {
 		utils.ErrorResponse(c, 500, "Failed to update channel access type")
 		return
 	}
 
+	if !wasMembersOnly && channel.IsMembersOnly() {
+		restrictChannelToMembers(channel.ID)
+	}
+
 	utils.SuccessResponse(c, 200, "Successfully changed channel access type", gin.H{
 		"channel_id":  channel.ID,
 		"access_type": channel.AccessType,
@@ -378,7 +402,7 @@ func ChangeChannelName(c *gin.Context) {
 		return
 	}
 
-	if channel.AdminID != user.ID {
+	if !hasChannelPermission(&channel, user.ID, models.PermRenameChannel) {
 		utils.ErrorResponse(c, 403, "Channel settings can't be changed by members")
 		return
 	}
@@ -393,3 +417,111 @@ func ChangeChannelName(c *gin.Context) {
 		"channel_name": channel.Name,
 	})
 }
+
+func TransferOwnership(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	var input struct {
+		UserID string `json:"user_id" binding:"required,uuid"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, 400, "A valid user_id is required")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if channel.IsDirect() || channel.AdminID != user.ID {
+		utils.ErrorResponse(c, 403, "Only channel owner can transfer ownership")
+		return
+	}
+
+	var newOwner models.User
+	if err := database.DB.First(&newOwner, "id = ?", input.UserID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if newOwner.ID == user.ID {
+		utils.ErrorResponse(c, 400, "You already own this channel")
+		return
+	}
+
+	if !isChannelMember(channel.ID, newOwner.ID) {
+		utils.ErrorResponse(c, 400, "New owner must be a member of this channel")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Guard on admin_id so two concurrent transfers can't both win
+		result := tx.Model(&models.Channel{}).
+			Where("id = ? AND admin_id = ?", channel.ID, user.ID).
+			Update("admin_id", newOwner.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOwnershipChanged
+		}
+
+		if err := tx.Model(user).Association("OwnedChannels").Delete(&channel); err != nil {
+			return err
+		}
+		if err := tx.Model(&newOwner).Association("OwnedChannels").Append(&channel); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.ChannelMember{}).
+			Where("channel_id = ? AND user_id = ?", channel.ID, newOwner.ID).
+			Update("role", models.RoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ChannelMember{}).
+			Where("channel_id = ? AND user_id = ?", channel.ID, user.ID).
+			Update("role", models.RoleModerator).Error
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errOwnershipChanged):
+		utils.ErrorResponse(c, 409, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to transfer ownership")
+		return
+	}
+
+	publishToChannel(channel.ID, WSMessage{
+		Type:    "system",
+		Content: user.Username + " transferred channel ownership to " + newOwner.Username,
+		User: map[string]any{
+			"id":       newOwner.ID,
+			"username": newOwner.Username,
+		},
+		Timestamp: time.Now(),
+	})
+
+	utils.SuccessResponse(c, 200, "Channel ownership transferred successfully", gin.H{
+		"channel_id": channel.ID,
+		"admin": gin.H{
+			"id":       newOwner.ID,
+			"username": newOwner.Username,
+		},
+	})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// directKey identifies the one DM channel a pair of users shares, whichever
+// side opened it
+func directKey(a, b uuid.UUID) string {
+	ids := []string{a.String(), b.String()}
+	sort.Strings(ids)
+	return strings.Join(ids, ":")
+}
+
+func OpenDirectMessage(c *gin.Context) {
+	var input struct {
+		Username string `json:"username" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, 400, "Username is required")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var other models.User
+	if err := database.DB.First(&other, "username = ?", strings.TrimSpace(input.Username)).Error; err != nil {
+		utils.ErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if other.ID == user.ID {
+		utils.ErrorResponse(c, 400, "You can't open a direct message with yourself")
+		return
+	}
+
+	key := directKey(user.ID, other.ID)
+	created := false
+
+	var channel models.Channel
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&channel, "direct_key = ?", key).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		names := []string{user.Username, other.Username}
+		sort.Strings(names)
+
+		channel = models.Channel{
+			ID:         uuid.New(),
+			Name:       strings.Join(names, ", "),
+			AccessType: "direct",
+			AdminID:    user.ID,
+			DirectKey:  &key,
+		}
+
+		if err := tx.Create(&channel).Error; err != nil {
+			return err
+		}
+		created = true
+
+		return tx.Model(&channel).Association("Members").Append(user, &other)
+	})
+
+	if err != nil {
+		// Both sides opened it at once and the other insert won the direct_key
+		if lookupErr := database.DB.First(&channel, "direct_key = ?", key).Error; lookupErr != nil {
+			utils.ErrorResponse(c, 500, "Failed to open direct message")
+			return
+		}
+		created = false
+	}
+
+	status := 200
+	if created {
+		status = 201
+	}
+
+	utils.SuccessResponse(c, status, "Direct message opened", gin.H{
+		"id":          channel.ID,
+		"access_type": channel.AccessType,
+		"user": gin.H{
+			"id":       other.ID,
+			"username": other.Username,
+		},
+		"created_at": channel.CreatedAt,
+	})
+}
+
+func ListDirectMessages(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var rows []struct {
+		ID                uuid.UUID
+		CreatedAt         time.Time
+		OtherID           uuid.UUID
+		OtherUsername     string
+		OtherLastOnline   time.Time
+		LastMessageID     *uuid.UUID
+		LastMessage       *string
+		LastMessageAt     *time.Time
+		LastMessageUserID *uuid.UUID
+	}
+
+	err := database.DB.Raw(`
+		SELECT channels.id, channels.created_at,
+			other_user.id AS other_id, other_user.username AS other_username, other_user.last_online AS other_last_online,
+			last_message.id AS last_message_id, last_message.content AS last_message,
+			last_message.created_at AS last_message_at, last_message.user_id AS last_message_user_id
+		FROM channels
+		JOIN channel_members me ON me.channel_id = channels.id AND me.user_id = ?
+		JOIN channel_members other ON other.channel_id = channels.id AND other.user_id <> ?
+		JOIN users other_user ON other_user.id = other.user_id
+		LEFT JOIN LATERAL (
+			SELECT id, LEFT(content, 200) AS content, created_at, user_id FROM messages
+			WHERE messages.channel_id = channels.id AND messages.deleted_at IS NULL
+			ORDER BY messages.sequence DESC, messages.created_at DESC
+			LIMIT 1
+		) last_message ON true
+		WHERE channels.access_type = 'direct' AND channels.deleted_at IS NULL
+		ORDER BY COALESCE(last_message.created_at, channels.created_at) DESC
+	`, user.ID, user.ID).Scan(&rows).Error
+
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch direct messages")
+		return
+	}
+
+	channelIDs := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		channelIDs = append(channelIDs, row.ID)
+	}
+	unread := unreadCounts(user, channelIDs)
+
+	response := []gin.H{}
+	for _, row := range rows {
+		var lastMessage gin.H
+		if row.LastMessageID != nil {
+			lastMessage = gin.H{
+				"id":         row.LastMessageID,
+				"content":    row.LastMessage,
+				"user_id":    row.LastMessageUserID,
+				"created_at": row.LastMessageAt,
+			}
+		}
+
+		response = append(response, gin.H{
+			"id": row.ID,
+			"user": gin.H{
+				"id":          row.OtherID,
+				"username":    row.OtherUsername,
+				"is_online":   hub.IsUserOnline(row.OtherID),
+				"presence":    hub.Presence(row.OtherID),
+				"last_online": row.OtherLastOnline,
+			},
+			"last_message":  lastMessage,
+			"unread_count":  unread[row.ID].Unread,
+			"mention_count": unread[row.ID].Mentions,
+			"created_at":    row.CreatedAt,
+		})
+	}
+
+	utils.SuccessResponse(c, 200, "Direct messages fetched successfully", response)
+}
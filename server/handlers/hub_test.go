@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/pubsub"
+	"github.com/google/uuid"
+)
+
+// newTestHub wires a hub to an in-memory broker without starting Run, so
+// clients can be attached directly and nothing touches the database
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+
+	broker := pubsub.NewMemoryBroker()
+	t.Cleanup(func() { broker.Close() })
+	return newTestHubOn(t, broker)
+}
+
+// newTestHubOn attaches another hub to broker, standing in for a second
+// server instance
+func newTestHubOn(t *testing.T, broker pubsub.Broker) *Hub {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events, err := broker.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	h := &Hub{
+		Clients:        make(map[*Client]bool),
+		Channels:       make(map[uuid.UUID]map[*Client]bool),
+		Broker:         broker,
+		userClients:    make(map[uuid.UUID]map[*Client]bool),
+		InstanceID:     uuid.New(),
+		announced:      make(map[uuid.UUID]string),
+		remotePresence: make(map[uuid.UUID]map[uuid.UUID]remoteStatus),
+	}
+	go h.Consume(events)
+	return h
+}
+
+func attachClient(h *Hub, username string, channelIDs ...uuid.UUID) *Client {
+	client := newClient(nil, &models.User{ID: uuid.New(), Username: username}, nil)
+
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	h.Clients[client] = true
+	h.userClients[client.User.ID] = map[*Client]bool{client: true}
+	for _, channelID := range channelIDs {
+		if h.Channels[channelID] == nil {
+			h.Channels[channelID] = make(map[*Client]bool)
+		}
+		h.Channels[channelID][client] = true
+		client.subscriptions[channelID] = &Subscription{Client: client, ChannelID: channelID, IsMember: true}
+	}
+	return client
+}
+
+func expectFrame(t *testing.T, client *Client, want string) {
+	t.Helper()
+	select {
+	case got := <-client.Send:
+		if string(got) != want {
+			t.Errorf("%s got %q, want %q", client.User.Username, got, want)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("%s got nothing, want %q", client.User.Username, want)
+	}
+}
+
+func expectNoFrame(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case got := <-client.Send:
+		t.Errorf("%s got unexpected frame %q", client.User.Username, got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHubFansOutToChannelSubscribers(t *testing.T) {
+	h := newTestHub(t)
+	channelID, otherChannelID := uuid.New(), uuid.New()
+
+	alice := attachClient(h, "alice", channelID)
+	bob := attachClient(h, "bob", channelID, otherChannelID)
+	carol := attachClient(h, "carol", otherChannelID)
+
+	h.BroadcastToChannel(channelID, []byte(`{"type":"message"}`), nil)
+
+	expectFrame(t, alice, `{"type":"message"}`)
+	expectFrame(t, bob, `{"type":"message"}`)
+	expectNoFrame(t, carol)
+}
+
+func TestHubSkipsExcludedClient(t *testing.T) {
+	h := newTestHub(t)
+	channelID := uuid.New()
+
+	sender := attachClient(h, "sender", channelID)
+	listener := attachClient(h, "listener", channelID)
+
+	h.BroadcastToChannel(channelID, []byte(`{"type":"typing"}`), sender)
+
+	expectFrame(t, listener, `{"type":"typing"}`)
+	expectNoFrame(t, sender)
+}
+
+func TestHubDeliversUserEventsRegardlessOfSubscriptions(t *testing.T) {
+	h := newTestHub(t)
+
+	target := attachClient(h, "target")
+	bystander := attachClient(h, "bystander", uuid.New())
+
+	h.publish(hubEvent{UserID: target.User.ID, Data: []byte(`{"type":"mention"}`)})
+
+	expectFrame(t, target, `{"type":"mention"}`)
+	expectNoFrame(t, bystander)
+}
+
+func TestHubMembershipControlEvents(t *testing.T) {
+	h := newTestHub(t)
+	channelID := uuid.New()
+
+	watcher := attachClient(h, "watcher", channelID)
+	member := attachClient(h, "member", channelID)
+
+	h.Mutex.Lock()
+	watcher.subscriptions[channelID].IsMember = false
+	h.Mutex.Unlock()
+
+	// Joining while subscribed refreshes the cached access
+	h.publish(hubEvent{Control: controlGrantMember, ChannelID: channelID, UserID: watcher.User.ID})
+	deadline := time.Now().Add(time.Second)
+	for {
+		h.Mutex.RLock()
+		granted := watcher.subscriptions[channelID].IsMember
+		h.Mutex.RUnlock()
+		if granted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription was not marked as a member's")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Kicking drops the subscription and tells the client
+	h.publish(hubEvent{Control: controlRevokeUser, ChannelID: channelID, UserID: watcher.User.ID})
+
+	select {
+	case frame := <-watcher.Send:
+		if !strings.Contains(string(frame), `"type":"unsubscribed"`) {
+			t.Errorf("watcher got %s, want an unsubscribed frame", frame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watcher was not told about losing access")
+	}
+
+	h.Mutex.RLock()
+	_, stillWatching := h.Channels[channelID][watcher]
+	_, memberWatching := h.Channels[channelID][member]
+	h.Mutex.RUnlock()
+	if stillWatching {
+		t.Error("revoked client is still subscribed")
+	}
+	if !memberWatching {
+		t.Error("other member lost their subscription")
+	}
+}
+
+func waitForPresence(t *testing.T, h *Hub, userID uuid.UUID, want string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for h.Presence(userID) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("presence = %q, want %q", h.Presence(userID), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPresenceCombinesInstances(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	t.Cleanup(func() { broker.Close() })
+
+	first := newTestHubOn(t, broker)
+	second := newTestHubOn(t, broker)
+
+	user := attachClient(first, "roamer")
+
+	idle := newClient(nil, user.User, nil)
+	idle.status = PresenceIdle
+	second.Mutex.Lock()
+	second.userClients[user.User.ID] = map[*Client]bool{idle: true}
+	second.Mutex.Unlock()
+
+	// Each instance only knows its own connection until they report
+	if got := second.Presence(user.User.ID); got != PresenceIdle {
+		t.Fatalf("second instance sees %q before any report, want idle", got)
+	}
+
+	first.publishPresence(map[uuid.UUID]string{user.User.ID: PresenceOnline})
+	second.publishPresence(map[uuid.UUID]string{user.User.ID: PresenceIdle})
+
+	// The busiest connection wins everywhere
+	waitForPresence(t, second, user.User.ID, PresenceOnline)
+	waitForPresence(t, first, user.User.ID, PresenceOnline)
+
+	second.presenceMu.Lock()
+	announced := second.announced[user.User.ID]
+	second.presenceMu.Unlock()
+	if announced != PresenceOnline {
+		t.Errorf("second instance recorded %q as announced, want online", announced)
+	}
+
+	// The online connection goes away; the idle one on the other instance remains
+	first.Mutex.Lock()
+	delete(first.userClients, user.User.ID)
+	first.Mutex.Unlock()
+	first.publishPresence(map[uuid.UUID]string{user.User.ID: PresenceOffline})
+
+	waitForPresence(t, second, user.User.ID, PresenceIdle)
+	waitForPresence(t, first, user.User.ID, PresenceIdle)
+}
+
+func TestPresenceExpiresSilentInstances(t *testing.T) {
+	h := newTestHub(t)
+	userID, deadInstance := uuid.New(), uuid.New()
+
+	h.remoteMu.Lock()
+	h.remotePresence[userID] = map[uuid.UUID]remoteStatus{
+		deadInstance: {Status: PresenceOnline, Seen: time.Now().Add(-2 * remotePresenceTTL)},
+	}
+	h.remoteMu.Unlock()
+
+	if got := h.Presence(userID); got != PresenceOffline {
+		t.Errorf("stale report still counts: presence = %q", got)
+	}
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInviteInvalid  = errors.New("Invite code is invalid or has been revoked")
+	errInviteExpired  = errors.New("Invite code has expired")
+	errInviteUsedUp   = errors.New("Invite code has reached its maximum uses")
+	errAlreadyMember  = errors.New("You are already a member of this channel")
+	errChannelMissing = errors.New("Channel not found")
+)
+
+func inviteResponse(invite models.Invite) gin.H {
+	return gin.H{
+		"id":         invite.ID,
+		"code":       invite.Code,
+		"channel_id": invite.ChannelID,
+		"created_by": invite.CreatedByID,
+		"max_uses":   invite.MaxUses,
+		"uses":       invite.Uses,
+		"expires_at": invite.ExpiresAt,
+		"created_at": invite.CreatedAt,
+	}
+}
+
+func CreateInvite(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	var input struct {
+		MaxUses        int `json:"max_uses" binding:"min=0"`
+		ExpiresInHours int `json:"expires_in_hours" binding:"min=0,max=720"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, 400, "Invalid input")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if !hasChannelPermission(&channel, user.ID, models.PermManageInvites) {
+		utils.ErrorResponse(c, 403, "You don't have permission to create invites")
+		return
+	}
+
+	code, err := utils.GenerateToken(12)
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to generate invite code")
+		return
+	}
+
+	invite := models.Invite{
+		ID:          uuid.New(),
+		Code:        code,
+		ChannelID:   channel.ID,
+		CreatedByID: user.ID,
+		MaxUses:     input.MaxUses,
+	}
+
+	if input.ExpiresInHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(input.ExpiresInHours) * time.Hour)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&invite).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to create invite")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, "Invite created successfully", inviteResponse(invite))
+}
+
+func ListInvites(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if !hasChannelPermission(&channel, user.ID, models.PermManageInvites) {
+		utils.ErrorResponse(c, 403, "You don't have permission to view invites")
+		return
+	}
+
+	var invites []models.Invite
+	if err := database.DB.
+		Where("channel_id = ?", channel.ID).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch invites")
+		return
+	}
+
+	response := []gin.H{}
+	for _, invite := range invites {
+		item := inviteResponse(invite)
+		item["is_expired"] = invite.IsExpired()
+		item["is_exhausted"] = invite.IsExhausted()
+		response = append(response, item)
+	}
+
+	utils.SuccessResponse(c, 200, "Invites fetched successfully", response)
+}
+
+func RevokeInvite(c *gin.Context) {
+	channelID := c.Param("id")
+	inviteID := c.Param("inviteId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(inviteID) {
+		utils.ErrorResponse(c, 400, "Invalid invite ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if !hasChannelPermission(&channel, user.ID, models.PermManageInvites) {
+		utils.ErrorResponse(c, 403, "You don't have permission to revoke invites")
+		return
+	}
+
+	var invite models.Invite
+	if err := database.DB.First(&invite, "id = ? AND channel_id = ?", inviteID, channel.ID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Invite not found")
+		return
+	}
+
+	if err := database.DB.Delete(&invite).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to revoke invite")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Invite revoked successfully", nil)
+}
+
+func RedeemInvite(c *gin.Context) {
+	code := c.Param("code")
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the invite row so concurrent redemptions can't overrun MaxUses
+		var invite models.Invite
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&invite, "code = ?", code).Error; err != nil {
+			return errInviteInvalid
+		}
+
+		if invite.IsExpired() {
+			return errInviteExpired
+		}
+
+		if invite.IsExhausted() {
+			return errInviteUsedUp
+		}
+
+		if err := tx.Preload("Members").First(&channel, "id = ?", invite.ChannelID).Error; err != nil {
+			return errChannelMissing
+		}
+
+		for _, member := range channel.Members {
+			if member.ID == user.ID {
+				return errAlreadyMember
+			}
+		}
+
+		if err := tx.Model(&channel).Association("Members").Append(user); err != nil {
+			return err
+		}
+
+		return tx.Model(&invite).Update("uses", gorm.Expr("uses + 1")).Error
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errInviteInvalid), errors.Is(err, errChannelMissing):
+		utils.ErrorResponse(c, 404, err.Error())
+		return
+	case errors.Is(err, errInviteExpired), errors.Is(err, errInviteUsedUp):
+		utils.ErrorResponse(c, 410, err.Error())
+		return
+	case errors.Is(err, errAlreadyMember):
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to redeem invite")
+		return
+	}
+
+	grantChannelMembership(channel.ID, user.ID)
+
+	utils.SuccessResponse(c, 200, "Successfully joined channel", gin.H{
+		"channel_id":   channel.ID,
+		"channel_name": channel.Name,
+	})
+}
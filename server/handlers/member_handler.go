@@ -1 +1,317 @@
 package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func ListMembers(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if channel.IsMembersOnly() && memberRole(&channel, user.ID) == "" {
+		utils.ErrorResponse(c, 403, "You don't have access to this channel")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := database.DB.Table("channel_members").
+		Joins("JOIN users ON users.id = channel_members.user_id AND users.deleted_at IS NULL").
+		Where("channel_members.channel_id = ?", channel.ID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch members")
+		return
+	}
+
+	var rows []struct {
+		ID         uuid.UUID
+		Username   string
+		LastOnline time.Time
+		Role       string
+		JoinedAt   time.Time
+	}
+
+	err := query.
+		Select("users.id, users.username, users.last_online, channel_members.role, channel_members.created_at AS joined_at").
+		Order("CASE channel_members.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 WHEN 'member' THEN 2 ELSE 3 END").
+		Order("users.username ASC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error
+
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch members")
+		return
+	}
+
+	members := []gin.H{}
+	for _, row := range rows {
+		role := row.Role
+		if row.ID == channel.AdminID {
+			role = models.RoleOwner
+		}
+
+		members = append(members, gin.H{
+			"id":          row.ID,
+			"username":    row.Username,
+			"role":        role,
+			"is_online":   hub.IsUserOnline(row.ID),
+			"presence":    hub.Presence(row.ID),
+			"last_online": row.LastOnline,
+			"joined_at":   row.JoinedAt,
+		})
+	}
+
+	utils.SuccessResponse(c, 200, "Members fetched successfully", gin.H{
+		"members":  members,
+		"total":    total,
+		"has_more": int64(offset+len(rows)) < total,
+	})
+}
+
+func AddMember(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	var input struct {
+		Username string `json:"username" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, 400, "Username is required")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if !hasChannelPermission(&channel, user.ID, models.PermManageMembers) {
+		utils.ErrorResponse(c, 403, "You don't have permission to add members")
+		return
+	}
+
+	if channel.AccessType != "private" {
+		utils.ErrorResponse(c, 400, "Public channels can be joined directly")
+		return
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, "username = ?", strings.TrimSpace(input.Username)).Error; err != nil {
+		utils.ErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if isChannelMember(channel.ID, target.ID) {
+		utils.ErrorResponse(c, 400, "User is already a member of this channel")
+		return
+	}
+
+	if err := database.DB.Model(&channel).Association("Members").Append(&target); err != nil {
+		utils.ErrorResponse(c, 500, "Failed to add member")
+		return
+	}
+
+	grantChannelMembership(channel.ID, target.ID)
+
+	publishToChannel(channel.ID, WSMessage{
+		Type: "member_added",
+		User: map[string]any{
+			"id":       target.ID,
+			"username": target.Username,
+		},
+		Timestamp: time.Now(),
+	})
+
+	utils.SuccessResponse(c, 201, "Member added successfully", gin.H{
+		"channel_id": channel.ID,
+		"user": gin.H{
+			"id":       target.ID,
+			"username": target.Username,
+		},
+		"role": models.RoleMember,
+	})
+}
+
+func KickMember(c *gin.Context) {
+	channelID := c.Param("id")
+	memberID := c.Param("userId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(memberID) {
+		utils.ErrorResponse(c, 400, "Invalid user ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	callerRole := memberRole(&channel, user.ID)
+	if !models.RoleHasPermission(callerRole, models.PermManageMembers) {
+		utils.ErrorResponse(c, 403, "You don't have permission to remove members")
+		return
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, "id = ?", memberID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	targetRole := memberRole(&channel, target.ID)
+	if targetRole == "" {
+		utils.ErrorResponse(c, 404, "User is not a member of this channel")
+		return
+	}
+
+	if !models.RoleOutranks(callerRole, targetRole) {
+		utils.ErrorResponse(c, 403, "You can only remove members with a lower role than yours")
+		return
+	}
+
+	if err := database.DB.Model(&channel).Association("Members").Delete(&target); err != nil {
+		utils.ErrorResponse(c, 500, "Failed to remove member")
+		return
+	}
+
+	revokeChannelAccess(channel.ID, target.ID)
+
+	publishToChannel(channel.ID, WSMessage{
+		Type: "member_removed",
+		User: map[string]any{
+			"id":       target.ID,
+			"username": target.Username,
+		},
+		Timestamp: time.Now(),
+	})
+
+	utils.SuccessResponse(c, 200, "Member removed successfully", gin.H{
+		"channel_id": channel.ID,
+		"user_id":    target.ID,
+	})
+}
+
+func ChangeMemberRole(c *gin.Context) {
+	channelID := c.Param("id")
+	memberID := c.Param("userId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(memberID) {
+		utils.ErrorResponse(c, 400, "Invalid user ID")
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required,oneof=moderator member read_only"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, 400, "Role must be one of moderator, member or read_only")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if !hasChannelPermission(&channel, user.ID, models.PermManageRoles) {
+		utils.ErrorResponse(c, 403, "Only channel owner can change member roles")
+		return
+	}
+
+	if channel.AdminID.String() == memberID {
+		utils.ErrorResponse(c, 400, "Channel owner's role can't be changed")
+		return
+	}
+
+	var member models.ChannelMember
+	if err := database.DB.First(&member, "channel_id = ? AND user_id = ?", channel.ID, memberID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "User is not a member of this channel")
+		return
+	}
+
+	if err := database.DB.Model(&member).Update("role", input.Role).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to update member role")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Member role updated successfully", gin.H{
+		"channel_id": channel.ID,
+		"user_id":    member.UserID,
+		"role":       input.Role,
+	})
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/markup"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Matches @name where name follows the username rules and isn't glued to a
+// preceding word, so email addresses don't count
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])@([A-Za-z0-9_]{3,50})\b`)
+
+const maxMentionsPerMessage = 50
+
+// parseMentions returns the distinct usernames mentioned in content and
+// whether it mentions @channel
+func parseMentions(content string) (usernames []string, everyone bool) {
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := match[1]
+		if name == "channel" {
+			everyone = true
+			continue
+		}
+		if seen[name] || len(usernames) >= maxMentionsPerMessage {
+			continue
+		}
+		seen[name] = true
+		usernames = append(usernames, name)
+	}
+	return usernames, everyone
+}
+
+// resolveMentions turns the names in message into mention rows for users who
+// can read the channel, leaving out the author
+func resolveMentions(tx *gorm.DB, message *models.Message) ([]models.Mention, error) {
+	usernames, everyone := parseMentions(message.Content)
+	if len(usernames) == 0 && !everyone {
+		return nil, nil
+	}
+
+	var channel models.Channel
+	if err := tx.First(&channel, "id = ?", message.ChannelID).Error; err != nil {
+		return nil, err
+	}
+
+	kinds := make(map[uuid.UUID]string)
+
+	if everyone {
+		var memberIDs []uuid.UUID
+		if err := tx.Model(&models.ChannelMember{}).
+			Where("channel_id = ?", channel.ID).
+			Pluck("user_id", &memberIDs).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range memberIDs {
+			kinds[id] = models.MentionChannel
+		}
+	}
+
+	if len(usernames) > 0 {
+		query := tx.Model(&models.User{}).Where("users.username IN ?", usernames)
+		if channel.IsMembersOnly() {
+			query = query.Joins("JOIN channel_members ON channel_members.user_id = users.id AND channel_members.channel_id = ?", channel.ID)
+		}
+
+		var userIDs []uuid.UUID
+		if err := query.Pluck("users.id", &userIDs).Error; err != nil {
+			return nil, err
+		}
+		// A direct @name outranks being swept up by @channel
+		for _, id := range userIDs {
+			kinds[id] = models.MentionUser
+		}
+	}
+
+	delete(kinds, message.UserID)
+
+	mentions := make([]models.Mention, 0, len(kinds))
+	for userID, kind := range kinds {
+		mentions = append(mentions, models.Mention{
+			MessageID: message.ID,
+			UserID:    userID,
+			ChannelID: message.ChannelID,
+			Kind:      kind,
+		})
+	}
+	return mentions, nil
+}
+
+// notifyMentions pings each mentioned user on all of their connections, even
+// ones not subscribed to the channel
+func notifyMentions(message models.Message, author *models.User) {
+	for _, mention := range message.Mentions {
+		msg := WSMessage{
+			Type:      "mention",
+			ChannelID: message.ChannelID.String(),
+			Content:   message.Content,
+			Tokens:    markup.Parse(message.Content),
+			MessageID: message.ID.String(),
+			Sequence:  message.Sequence,
+			User: map[string]any{
+				"id":       author.ID,
+				"username": author.Username,
+			},
+			Timestamp: message.CreatedAt,
+		}
+		if message.ParentID != nil {
+			msg.ParentID = message.ParentID.String()
+		}
+		publishToUser(mention.UserID, msg)
+	}
+}
+
+func ListMentions(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	// Mentions outlive a lost membership, so access is checked again here
+	query := database.DB.Table("mentions").
+		Select(`mentions.message_id, mentions.kind, mentions.created_at,
+			messages.content, messages.parent_id, messages.sequence,
+			channels.id AS channel_id, channels.name AS channel_name, channels.access_type,
+			users.id AS author_id, users.username AS author_username,
+			messages.sequence <= COALESCE(channel_members.last_read_seq, 0) AS is_read`).
+		Joins("JOIN messages ON messages.id = mentions.message_id AND messages.deleted_at IS NULL").
+		Joins("JOIN channels ON channels.id = mentions.channel_id AND channels.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = messages.user_id").
+		Joins("LEFT JOIN channel_members ON channel_members.channel_id = mentions.channel_id AND channel_members.user_id = mentions.user_id").
+		Where("mentions.user_id = ?", user.ID).
+		Where("channels.access_type = 'public' OR channel_members.user_id IS NOT NULL")
+
+	if c.Query("unread") == "true" {
+		query = query.Where("messages.sequence > COALESCE(channel_members.last_read_seq, 0)")
+	}
+
+	// Newest first; the cursor is the message ID of the last mention on the previous page
+	if cursor := c.Query("cursor"); cursor != "" {
+		if !utils.IsValidUUID(cursor) {
+			utils.ErrorResponse(c, 400, "Invalid cursor")
+			return
+		}
+
+		var cursorMention models.Mention
+		if err := database.DB.First(&cursorMention, "message_id = ? AND user_id = ?", cursor, user.ID).Error; err == nil {
+			query = query.Where("(mentions.created_at, mentions.message_id) < (?, ?)", cursorMention.CreatedAt, cursorMention.MessageID)
+		}
+	}
+
+	var rows []struct {
+		MessageID      uuid.UUID
+		Kind           string
+		CreatedAt      time.Time
+		Content        string
+		ParentID       *uuid.UUID
+		Sequence       int64
+		ChannelID      uuid.UUID
+		ChannelName    string
+		AccessType     string
+		AuthorID       uuid.UUID
+		AuthorUsername string
+		IsRead         bool
+	}
+
+	err := query.
+		Order("mentions.created_at DESC, mentions.message_id DESC").
+		Limit(limit + 1).
+		Scan(&rows).Error
+
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch mentions")
+		return
+	}
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	mentions := []gin.H{}
+	for _, row := range rows {
+		mentions = append(mentions, gin.H{
+			"message_id": row.MessageID,
+			"kind":       row.Kind,
+			"content":    row.Content,
+			"parent_id":  row.ParentID,
+			"sequence":   row.Sequence,
+			"is_read":    row.IsRead,
+			"created_at": row.CreatedAt,
+			"channel": gin.H{
+				"id":          row.ChannelID,
+				"name":        row.ChannelName,
+				"access_type": row.AccessType,
+			},
+			"user": gin.H{
+				"id":       row.AuthorID,
+				"username": row.AuthorUsername,
+			},
+		})
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := rows[len(rows)-1].MessageID.String()
+		nextCursor = &last
+	}
+
+	utils.SuccessResponse(c, 200, "Mentions fetched successfully", gin.H{
+		"mentions":    mentions,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	})
+}
@@ -1,17 +1,101 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 	"time"
 
 	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/markup"
 	"github.com/RudraPatel5435/vyenet/server/middleware"
 	"github.com/RudraPatel5435/vyenet/server/models"
 	"github.com/RudraPatel5435/vyenet/server/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+var (
+	errParentMissing = errors.New("Parent message not found")
+	errNestedThread  = errors.New("Replies can't be threaded further")
+)
+
+// saveMessage persists message with the next sequence number for its channel.
+// Bumping channels.last_seq row-locks the channel, so sequences commit in order.
+func saveMessage(message *models.Message) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw("UPDATE channels SET last_seq = last_seq + 1 WHERE id = ? RETURNING last_seq", message.ChannelID).
+			Scan(&message.Sequence).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Omit("Attachments", "Mentions").Create(message).Error; err != nil {
+			return err
+		}
+
+		mentions, err := resolveMentions(tx, message)
+		if err != nil {
+			return err
+		}
+		if len(mentions) > 0 {
+			if err := tx.Create(&mentions).Error; err != nil {
+				return err
+			}
+		}
+		message.Mentions = mentions
+
+		if err := linkAttachments(tx, message); err != nil {
+			return err
+		}
+
+		// Whoever posts has obviously read up to their own message
+		if err := tx.Model(&models.ChannelMember{}).
+			Where("channel_id = ? AND user_id = ? AND last_read_seq < ?", message.ChannelID, message.UserID, message.Sequence).
+			UpdateColumns(map[string]any{
+				"last_read_seq": message.Sequence,
+				"last_read_at":  time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+
+		if message.ParentID == nil {
+			return nil
+		}
+
+		// UpdateColumns so a new reply doesn't mark the parent as edited
+		return tx.Model(&models.Message{}).
+			Where("id = ?", *message.ParentID).
+			UpdateColumns(map[string]any{
+				"reply_count":   gorm.Expr("reply_count + 1"),
+				"last_reply_at": message.CreatedAt,
+			}).Error
+	})
+}
+
+// resolveParent validates a reply target: it must be a top-level message in
+// the same channel
+func resolveParent(channelID uuid.UUID, parentID string) (*uuid.UUID, error) {
+	if parentID == "" {
+		return nil, nil
+	}
+
+	if !utils.IsValidUUID(parentID) {
+		return nil, errParentMissing
+	}
+
+	var parent models.Message
+	if err := database.DB.First(&parent, "id = ? AND channel_id = ?", parentID, channelID).Error; err != nil {
+		return nil, errParentMissing
+	}
+
+	if parent.ParentID != nil {
+		return nil, errNestedThread
+	}
+
+	return &parent.ID, nil
+}
+
 func CreateMessage(c *gin.Context) {
 	channelID := c.Param("id")
 
@@ -21,11 +105,13 @@ func CreateMessage(c *gin.Context) {
 	}
 
 	var input struct {
-		Content string `json:"content" binding:"required"`
+		Content       string   `json:"content"`
+		ParentID      string   `json:"parent_id"`
+		AttachmentIDs []string `json:"attachment_ids"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		utils.ErrorResponse(c, 400, "Content is required")
+		utils.ErrorResponse(c, 400, "Invalid input")
 		return
 	}
 
@@ -35,53 +121,23 @@ func CreateMessage(c *gin.Context) {
 		return
 	}
 
-	var channel models.Channel
-	if err := database.DB.Preload("Members").First(&channel, "id = ?", channelID).Error; err != nil {
-		utils.ErrorResponse(c, 404, "Channel not found")
-		return
-	}
-
-	isMember := false
-	for _, member := range channel.Members {
-		if member.ID == user.ID {
-			isMember = true
-			break
+	message, err := postMessage(user, postMessageInput{
+		ChannelID:     uuid.MustParse(channelID),
+		Content:       input.Content,
+		ParentID:      input.ParentID,
+		AttachmentIDs: input.AttachmentIDs,
+	})
+	if err != nil {
+		var rejected *postError
+		if errors.As(err, &rejected) {
+			utils.ErrorResponse(c, rejected.Status, rejected.Message)
+			return
 		}
-	}
-
-	if !isMember {
-		utils.ErrorResponse(c, 403, "You must be a member to send messages in this channel")
-		return
-	}
-
-	if len(input.Content) > 2000 {
-		utils.ErrorResponse(c, 400, "Message content must be less than 2000 characters")
-		return
-	}
-
-	message := models.Message{
-		ID:        uuid.New(),
-		Content:   input.Content,
-		UserID:    user.ID,
-		ChannelID: uuid.MustParse(channelID),
-	}
-
-	if err := database.DB.Create(&message).Error; err != nil {
 		utils.ErrorResponse(c, 500, "Failed to create message")
 		return
 	}
 
-	database.DB.Preload("User").First(&message, "id = ?", message.ID)
-
-	utils.SuccessResponse(c, 201, "Message created successfully", gin.H{
-		"id":         message.ID,
-		"content":    message.Content,
-		"created_at": message.CreatedAt,
-		"user": gin.H{
-			"id":       message.User.ID,
-			"username": message.User.Username,
-		},
-	})
+	utils.SuccessResponse(c, 201, "Message created successfully", messageResponse(*message, nil))
 }
 
 func ListMessages(c *gin.Context) {
@@ -104,7 +160,7 @@ func ListMessages(c *gin.Context) {
 		return
 	}
 
-	if channel.AccessType == "private" {
+	if channel.IsMembersOnly() {
 		isMember := false
 		for _, member := range channel.Members {
 			if member.ID == user.ID {
@@ -118,6 +174,24 @@ func ListMessages(c *gin.Context) {
 		}
 	}
 
+	query := database.DB.
+		Preload("User").
+		Preload("Attachments").
+		Preload("Embeds", orderEmbeds).
+		Where("channel_id = ? AND parent_id IS NULL", channelID)
+
+	messages, hasMore, err := fetchMessagePage(c, query)
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch messages")
+		return
+	}
+
+	respondMessagePage(c, messages, hasMore, nil)
+}
+
+// fetchMessagePage applies the limit and before/after cursors shared by every
+// message listing, returning messages oldest-first for "after" pages
+func fetchMessagePage(c *gin.Context, query *gorm.DB) ([]models.Message, bool, error) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	if limit < 1 || limit > 100 {
 		limit = 50
@@ -126,10 +200,6 @@ func ListMessages(c *gin.Context) {
 	beforeCursor := c.Query("before")
 	afterCursor := c.Query("after")
 
-	query := database.DB.
-		Preload("User").
-		Where("channel_id = ?", channelID)
-
 	if beforeCursor != "" {
 		var cursorMsg models.Message
 		if err := database.DB.First(&cursorMsg, "id = ?", beforeCursor).Error; err == nil {
@@ -147,11 +217,8 @@ func ListMessages(c *gin.Context) {
 	}
 
 	var messages []models.Message
-	err := query.Limit(limit + 1).Find(&messages).Error
-
-	if err != nil {
-		utils.ErrorResponse(c, 500, "Failed to fetch messages")
-		return
+	if err := query.Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
 	}
 
 	hasMore := len(messages) > limit
@@ -165,18 +232,50 @@ func ListMessages(c *gin.Context) {
 		}
 	}
 
+	return messages, hasMore, nil
+}
+
+func messageResponse(msg models.Message, reactions []gin.H) gin.H {
+	if reactions == nil {
+		reactions = []gin.H{}
+	}
+
+	return gin.H{
+		"id":            msg.ID,
+		"sequence":      msg.Sequence,
+		"content":       msg.Content,
+		"tokens":        markup.Parse(msg.Content),
+		"parent_id":     msg.ParentID,
+		"reply_count":   msg.ReplyCount,
+		"last_reply_at": msg.LastReplyAt,
+		"is_pinned":     msg.IsPinned,
+		"reactions":     reactions,
+		"attachments":   attachmentsResponse(msg.Attachments),
+		"embeds":        embedsResponse(msg.Embeds),
+		"created_at":    msg.CreatedAt,
+		"edited_at":     msg.EditedAt,
+		"user": gin.H{
+			"id":       msg.User.ID,
+			"username": msg.User.Username,
+		},
+	}
+}
+
+func respondMessagePage(c *gin.Context, messages []models.Message, hasMore bool, extra gin.H) {
+	var userID uuid.UUID
+	if user := middleware.GetCurrentUser(c); user != nil {
+		userID = user.ID
+	}
+
+	messageIDs := make([]uuid.UUID, 0, len(messages))
+	for _, msg := range messages {
+		messageIDs = append(messageIDs, msg.ID)
+	}
+	reactions := summarizeReactions(messageIDs, userID)
+
 	var response []gin.H
 	for _, msg := range messages {
-		response = append(response, gin.H{
-			"id":         msg.ID,
-			"content":    msg.Content,
-			"is_pinned":  msg.IsPinned,
-			"created_at": msg.CreatedAt,
-			"user": gin.H{
-				"id":       msg.User.ID,
-				"username": msg.User.Username,
-			},
-		})
+		response = append(response, messageResponse(msg, reactions[msg.ID]))
 	}
 
 	var firstCursor, lastCursor *string
@@ -187,15 +286,428 @@ func ListMessages(c *gin.Context) {
 		lastCursor = &last
 	}
 
+	data := gin.H{
+		"messages":     response,
+		"has_more":     hasMore,
+		"first_cursor": firstCursor,
+		"last_cursor":  lastCursor,
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+
 	c.JSON(200, gin.H{
-		"success": true,
-		"message": "Messages fetched successfully",
-		"data": gin.H{
-			"messages":     response,
-			"has_more":     hasMore,
-			"first_cursor": firstCursor,
-			"last_cursor":  lastCursor,
-		},
+		"success":   true,
+		"message":   "Messages fetched successfully",
+		"data":      data,
 		"timestamp": time.Now(),
 	})
 }
+
+func ListThread(c *gin.Context) {
+	channelID := c.Param("id")
+	messageID := c.Param("messageId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(messageID) {
+		utils.ErrorResponse(c, 400, "Invalid message ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if channel.IsMembersOnly() && memberRole(&channel, user.ID) == "" {
+		utils.ErrorResponse(c, 403, "You don't have access to this private channel")
+		return
+	}
+
+	var parent models.Message
+	if err := database.DB.Preload("User").Preload("Attachments").Preload("Embeds", orderEmbeds).First(&parent, "id = ? AND channel_id = ?", messageID, channel.ID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Message not found")
+		return
+	}
+
+	if parent.ParentID != nil {
+		utils.ErrorResponse(c, 400, "Message is a reply, not a thread")
+		return
+	}
+
+	query := database.DB.
+		Preload("User").
+		Preload("Attachments").
+		Preload("Embeds", orderEmbeds).
+		Where("parent_id = ?", parent.ID)
+
+	replies, hasMore, err := fetchMessagePage(c, query)
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch thread")
+		return
+	}
+
+	respondMessagePage(c, replies, hasMore, gin.H{
+		"parent": messageResponse(parent, summarizeReactions([]uuid.UUID{parent.ID}, user.ID)[parent.ID]),
+	})
+}
+
+func EditMessage(c *gin.Context) {
+	channelID := c.Param("id")
+	messageID := c.Param("messageId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(messageID) {
+		utils.ErrorResponse(c, 400, "Invalid message ID")
+		return
+	}
+
+	var input struct {
+		Content string `json:"content" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, 400, "Content is required")
+		return
+	}
+
+	if len(input.Content) > 2000 {
+		utils.ErrorResponse(c, 400, "Message content must be less than 2000 characters")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	if !middleware.CanPost(user) {
+		utils.ErrorResponse(c, 403, errEmailUnverified.Error())
+		return
+	}
+
+	var message models.Message
+	if err := database.DB.Preload("User").First(&message, "id = ? AND channel_id = ?", messageID, channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Message not found")
+		return
+	}
+
+	if message.UserID != user.ID {
+		utils.ErrorResponse(c, 403, "You can only edit your own messages")
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&message).Updates(map[string]any{
+		"content":   input.Content,
+		"edited_at": now,
+	}).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to edit message")
+		return
+	}
+
+	enqueueUnfurl(message, true)
+
+	publishToChannel(message.ChannelID, WSMessage{
+		Type:      "message_edited",
+		Content:   message.Content,
+		Tokens:    markup.Parse(message.Content),
+		MessageID: message.ID.String(),
+		User: map[string]any{
+			"id":       user.ID,
+			"username": user.Username,
+		},
+		Timestamp: now,
+	})
+
+	utils.SuccessResponse(c, 200, "Message edited successfully", gin.H{
+		"id":         message.ID,
+		"content":    message.Content,
+		"tokens":     markup.Parse(message.Content),
+		"created_at": message.CreatedAt,
+		"edited_at":  message.EditedAt,
+		"user": gin.H{
+			"id":       message.User.ID,
+			"username": message.User.Username,
+		},
+	})
+}
+
+func DeleteMessage(c *gin.Context) {
+	channelID := c.Param("id")
+	messageID := c.Param("messageId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(messageID) {
+		utils.ErrorResponse(c, 400, "Invalid message ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	var message models.Message
+	if err := database.DB.First(&message, "id = ? AND channel_id = ?", messageID, channel.ID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Message not found")
+		return
+	}
+
+	if message.UserID != user.ID && !hasChannelPermission(&channel, user.ID, models.PermDeleteMessages) {
+		utils.ErrorResponse(c, 403, "You can only delete your own messages")
+		return
+	}
+
+	var replyIDs []uuid.UUID
+	var attachments []models.Attachment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&message).Error; err != nil {
+			return err
+		}
+
+		if message.ParentID == nil {
+			// A thread goes with its parent, otherwise the replies are left
+			// pointing at a message nobody can open
+			if err := tx.Model(&models.Message{}).Where("parent_id = ?", message.ID).Pluck("id", &replyIDs).Error; err != nil {
+				return err
+			}
+			if len(replyIDs) > 0 {
+				if err := tx.Where("id IN ?", replyIDs).Delete(&models.Message{}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		deletedIDs := append([]uuid.UUID{message.ID}, replyIDs...)
+		if err := tx.Where("message_id IN ?", deletedIDs).Find(&attachments).Error; err != nil {
+			return err
+		}
+		if len(attachments) > 0 {
+			if err := tx.Where("message_id IN ?", deletedIDs).Delete(&models.Attachment{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if message.ParentID == nil {
+			return nil
+		}
+
+		// Recount from what's left so last_reply_at falls back to the newest
+		// surviving reply
+		return tx.Model(&models.Message{}).
+			Where("id = ?", *message.ParentID).
+			UpdateColumns(map[string]any{
+				"reply_count":   gorm.Expr("(SELECT COUNT(*) FROM messages replies WHERE replies.parent_id = messages.id AND replies.deleted_at IS NULL)"),
+				"last_reply_at": gorm.Expr("(SELECT MAX(created_at) FROM messages replies WHERE replies.parent_id = messages.id AND replies.deleted_at IS NULL)"),
+			}).Error
+	})
+
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to delete message")
+		return
+	}
+
+	// The rows are already hidden; the janitor retries any file this misses
+	go purgeAttachments(attachments)
+
+	for _, id := range append([]uuid.UUID{message.ID}, replyIDs...) {
+		publishToChannel(channel.ID, WSMessage{
+			Type:      "message_deleted",
+			MessageID: id.String(),
+			User: map[string]any{
+				"id":       user.ID,
+				"username": user.Username,
+			},
+			Timestamp: time.Now(),
+		})
+	}
+
+	utils.SuccessResponse(c, 200, "Message deleted successfully", gin.H{
+		"id": message.ID,
+	})
+}
+
+func PinMessage(c *gin.Context) {
+	setMessagePinned(c, true)
+}
+
+func UnpinMessage(c *gin.Context) {
+	setMessagePinned(c, false)
+}
+
+func setMessagePinned(c *gin.Context, pinned bool) {
+	channelID := c.Param("id")
+	messageID := c.Param("messageId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(messageID) {
+		utils.ErrorResponse(c, 400, "Invalid message ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if !hasChannelPermission(&channel, user.ID, models.PermPinMessages) {
+		utils.ErrorResponse(c, 403, "You don't have permission to pin messages")
+		return
+	}
+
+	var message models.Message
+	if err := database.DB.First(&message, "id = ? AND channel_id = ?", messageID, channel.ID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Message not found")
+		return
+	}
+
+	if message.IsPinned == pinned {
+		if pinned {
+			utils.ErrorResponse(c, 400, "Message is already pinned")
+		} else {
+			utils.ErrorResponse(c, 400, "Message is not pinned")
+		}
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"is_pinned": pinned,
+		"pinned_at": nil,
+		"pinned_by": nil,
+	}
+	if pinned {
+		updates["pinned_at"] = now
+		updates["pinned_by"] = user.ID
+	}
+
+	// UpdateColumns so pinning doesn't bump updated_at
+	if err := database.DB.Model(&message).UpdateColumns(updates).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to update pinned state")
+		return
+	}
+
+	eventType := "message_unpinned"
+	if pinned {
+		eventType = "message_pinned"
+	}
+
+	publishToChannel(channel.ID, WSMessage{
+		Type:      eventType,
+		MessageID: message.ID.String(),
+		User: map[string]any{
+			"id":       user.ID,
+			"username": user.Username,
+		},
+		Timestamp: now,
+	})
+
+	utils.SuccessResponse(c, 200, "Message pinned state updated", gin.H{
+		"id":        message.ID,
+		"is_pinned": pinned,
+		"pinned_at": message.PinnedAt,
+	})
+}
+
+func ListPinnedMessages(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.Preload("Members").First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	if channel.IsMembersOnly() {
+		isMember := false
+		for _, member := range channel.Members {
+			if member.ID == user.ID {
+				isMember = true
+				break
+			}
+		}
+		if !isMember && channel.AdminID != user.ID {
+			utils.ErrorResponse(c, 403, "You don't have access to this private channel")
+			return
+		}
+	}
+
+	var messages []models.Message
+	if err := database.DB.
+		Preload("User").
+		Where("channel_id = ? AND is_pinned = ?", channel.ID, true).
+		Order("pinned_at ASC").
+		Find(&messages).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to fetch pinned messages")
+		return
+	}
+
+	response := []gin.H{}
+	for _, msg := range messages {
+		response = append(response, gin.H{
+			"id":         msg.ID,
+			"content":    msg.Content,
+			"tokens":     markup.Parse(msg.Content),
+			"created_at": msg.CreatedAt,
+			"edited_at":  msg.EditedAt,
+			"pinned_at":  msg.PinnedAt,
+			"pinned_by":  msg.PinnedBy,
+			"user": gin.H{
+				"id":       msg.User.ID,
+				"username": msg.User.Username,
+			},
+		})
+	}
+
+	utils.SuccessResponse(c, 200, "Pinned messages fetched successfully", response)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/google/uuid"
+)
+
+const maxMessageLength = 2000
+
+type postMessageInput struct {
+	ChannelID     uuid.UUID
+	Content       string
+	ParentID      string
+	AttachmentIDs []string
+}
+
+// postError is a rejection the sender should see. Status is what REST
+// answers with; the socket relays Message as an error frame.
+type postError struct {
+	Status  int
+	Message string
+}
+
+func (e *postError) Error() string {
+	return e.Message
+}
+
+// postMessage is the one way a message gets sent, whether it arrives over
+// REST or the socket: it checks the author may post, saves the message and
+// fans it out to the channel, mentioned users and the unfurler.
+func postMessage(author *models.User, input postMessageInput) (*models.Message, error) {
+	if !middleware.CanPost(author) {
+		return nil, &postError{403, errEmailUnverified.Error()}
+	}
+
+	if input.Content == "" && len(input.AttachmentIDs) == 0 {
+		return nil, &postError{400, "Content is required"}
+	}
+
+	if len(input.Content) > maxMessageLength {
+		return nil, &postError{400, "Message content must be less than 2000 characters"}
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", input.ChannelID).Error; err != nil {
+		return nil, &postError{404, errChannelMissing.Error()}
+	}
+
+	role := memberRole(&channel, author.ID)
+	if role == "" {
+		return nil, &postError{403, "You must be a member to send messages in this channel"}
+	}
+
+	if !models.RoleHasPermission(role, models.PermSendMessages) {
+		return nil, &postError{403, "You don't have permission to send messages in this channel"}
+	}
+
+	parentID, err := resolveParent(channel.ID, input.ParentID)
+	if err != nil {
+		return nil, &postError{400, err.Error()}
+	}
+
+	attachments, err := resolveAttachments(channel.ID, author.ID, input.AttachmentIDs)
+	if err != nil {
+		return nil, &postError{400, err.Error()}
+	}
+
+	message := models.Message{
+		ID:          uuid.New(),
+		Content:     input.Content,
+		UserID:      author.ID,
+		User:        author,
+		ChannelID:   channel.ID,
+		ParentID:    parentID,
+		Attachments: attachments,
+	}
+
+	if err := saveMessage(&message); err != nil {
+		if errors.Is(err, errAttachmentInvalid) {
+			return nil, &postError{400, err.Error()}
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	author.LastOnline = now
+	database.DB.Model(author).Update("last_online", now)
+
+	data, err := json.Marshal(messageEvent(message, author))
+	if err != nil {
+		log.Printf("Failed to marshal message event: %v", err)
+	} else {
+		hub.Broadcast <- &BroadcastMessage{
+			ChannelID: channel.ID,
+			Sequence:  message.Sequence,
+			Data:      data,
+		}
+	}
+
+	notifyMentions(message, author)
+	enqueueUnfurl(message, false)
+
+	return &message, nil
+}
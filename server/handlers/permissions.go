@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/google/uuid"
+)
+
+// memberRole resolves the user's role in the channel, or "" for non-members.
+// The channel admin is always the owner, which also covers rows created before
+// roles existed. Direct messages have no owner; both sides are plain members.
+func memberRole(channel *models.Channel, userID uuid.UUID) string {
+	if channel.AdminID == userID && !channel.IsDirect() {
+		return models.RoleOwner
+	}
+
+	var member models.ChannelMember
+	if err := database.DB.First(&member, "channel_id = ? AND user_id = ?", channel.ID, userID).Error; err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+func hasChannelPermission(channel *models.Channel, userID uuid.UUID, perm models.Permission) bool {
+	return models.RoleHasPermission(memberRole(channel, userID), perm)
+}
+
+func isChannelMember(channelID, userID uuid.UUID) bool {
+	var count int64
+	database.DB.Model(&models.ChannelMember{}).
+		Where("channel_id = ? AND user_id = ?", channelID, userID).
+		Count(&count)
+	return count > 0
+}
+
+func countChannelMembers(channelIDs []uuid.UUID) map[uuid.UUID]int64 {
+	var rows []struct {
+		ChannelID uuid.UUID
+		Count     int64
+	}
+	database.DB.Model(&models.ChannelMember{}).
+		Select("channel_id, COUNT(*) AS count").
+		Where("channel_id IN ?", channelIDs).
+		Group("channel_id").
+		Scan(&rows)
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ChannelID] = row.Count
+	}
+	return counts
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/google/uuid"
+)
+
+const (
+	PresenceOnline  = "online"
+	PresenceIdle    = "idle"
+	PresenceDND     = "dnd"
+	PresenceOffline = "offline"
+)
+
+// Every instance republishes the statuses of its connected users this often;
+// a report that isn't renewed in remotePresenceTTL is assumed to come from an
+// instance that died
+const (
+	presenceSyncInterval = 30 * time.Second
+	remotePresenceTTL    = 3 * presenceSyncInterval
+	presenceSyncBatch    = 500
+)
+
+// remoteStatus is what another instance last reported for one user
+type remoteStatus struct {
+	Status string
+	Seen   time.Time
+}
+
+// presenceRank folds a user's connections into one status: the highest wins,
+// so one active tab beats several idle ones and do-not-disturb beats both
+var presenceRank = map[string]int{
+	PresenceOffline: 0,
+	PresenceIdle:    1,
+	PresenceOnline:  2,
+	PresenceDND:     3,
+}
+
+func isSettablePresence(status string) bool {
+	return status == PresenceOnline || status == PresenceIdle || status == PresenceDND
+}
+
+// userPresence must be called with h.Mutex held
+func (h *Hub) userPresence(userID uuid.UUID) string {
+	status := PresenceOffline
+	for client := range h.userClients[userID] {
+		if presenceRank[client.status] > presenceRank[status] {
+			status = client.status
+		}
+	}
+	return status
+}
+
+// Presence is the user's status across every connection, on this instance
+// and on the others that report through the broker
+func (h *Hub) Presence(userID uuid.UUID) string {
+	h.Mutex.RLock()
+	status := h.userPresence(userID)
+	h.Mutex.RUnlock()
+
+	h.remoteMu.RLock()
+	defer h.remoteMu.RUnlock()
+	for _, remote := range h.remotePresence[userID] {
+		if time.Since(remote.Seen) <= remotePresenceTTL && presenceRank[remote.Status] > presenceRank[status] {
+			status = remote.Status
+		}
+	}
+	return status
+}
+
+func (h *Hub) IsUserOnline(userID uuid.UUID) bool {
+	return h.Presence(userID) != PresenceOffline
+}
+
+// setStatus records a status the client asked for over its socket
+func (h *Hub) setStatus(client *Client, status string) {
+	h.Mutex.Lock()
+	client.status = status
+	h.Mutex.Unlock()
+
+	h.refreshPresence(client.User)
+}
+
+// refreshPresence runs after a local connect, disconnect or status frame. It
+// reports this instance's view to the others, then announces the combined
+// status if it changed. Only the instance where the change happened
+// announces, so a user connected to several doesn't flicker between them.
+// presenceMu keeps concurrent refreshes from announcing out of order.
+func (h *Hub) refreshPresence(user *models.User) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	h.Mutex.RLock()
+	local := h.userPresence(user.ID)
+	h.Mutex.RUnlock()
+
+	h.publishPresence(map[uuid.UUID]string{user.ID: local})
+	h.announcePresence(user, h.Presence(user.ID))
+}
+
+// announcePresence tells the user's channels about status if it differs from
+// what was last announced. It must be called with presenceMu held.
+func (h *Hub) announcePresence(user *models.User, status string) {
+	previous, ok := h.announced[user.ID]
+	if !ok {
+		previous = PresenceOffline
+	}
+	if status == previous {
+		return
+	}
+
+	if status == PresenceOffline {
+		delete(h.announced, user.ID)
+
+		now := time.Now()
+		database.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("last_online", now)
+	} else {
+		h.announced[user.ID] = status
+	}
+
+	var channelIDs []uuid.UUID
+	if err := database.DB.Model(&models.ChannelMember{}).
+		Where("user_id = ?", user.ID).
+		Pluck("channel_id", &channelIDs).Error; err != nil {
+		log.Printf("Failed to load channels for presence update: %v", err)
+		return
+	}
+
+	for _, channelID := range channelIDs {
+		publishToChannel(channelID, WSMessage{
+			Type:   "presence_update",
+			Status: status,
+			User: map[string]any{
+				"id":       user.ID,
+				"username": user.Username,
+			},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+func (h *Hub) publishPresence(statuses map[uuid.UUID]string) {
+	h.publish(hubEvent{
+		Control:  controlPresence,
+		Instance: h.InstanceID,
+		Presence: statuses,
+	})
+}
+
+// mergeRemotePresence records another instance's report. The change was
+// already announced where it happened, so this only brings the local record
+// of what was announced into line.
+func (h *Hub) mergeRemotePresence(event hubEvent) {
+	if event.Instance == h.InstanceID {
+		return
+	}
+
+	now := time.Now()
+	h.remoteMu.Lock()
+	for userID, status := range event.Presence {
+		instances := h.remotePresence[userID]
+		if status == PresenceOffline {
+			delete(instances, event.Instance)
+			if len(instances) == 0 {
+				delete(h.remotePresence, userID)
+			}
+			continue
+		}
+		if instances == nil {
+			instances = make(map[uuid.UUID]remoteStatus)
+			h.remotePresence[userID] = instances
+		}
+		instances[event.Instance] = remoteStatus{Status: status, Seen: now}
+	}
+	h.remoteMu.Unlock()
+
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	for userID := range event.Presence {
+		if status := h.Presence(userID); status == PresenceOffline {
+			delete(h.announced, userID)
+		} else {
+			h.announced[userID] = status
+		}
+	}
+}
+
+// syncPresence renews this instance's reports and forgets reports that have
+// gone stale
+func (h *Hub) syncPresence() {
+	h.Mutex.RLock()
+	statuses := make(map[uuid.UUID]string, len(h.userClients))
+	for userID := range h.userClients {
+		statuses[userID] = h.userPresence(userID)
+	}
+	h.Mutex.RUnlock()
+
+	batch := make(map[uuid.UUID]string, presenceSyncBatch)
+	for userID, status := range statuses {
+		batch[userID] = status
+		if len(batch) == presenceSyncBatch {
+			h.publishPresence(batch)
+			batch = make(map[uuid.UUID]string, presenceSyncBatch)
+		}
+	}
+	if len(batch) > 0 {
+		h.publishPresence(batch)
+	}
+
+	var expired []uuid.UUID
+	h.remoteMu.Lock()
+	for userID, instances := range h.remotePresence {
+		for instance, remote := range instances {
+			if time.Since(remote.Seen) > remotePresenceTTL {
+				delete(instances, instance)
+				expired = append(expired, userID)
+			}
+		}
+		if len(instances) == 0 {
+			delete(h.remotePresence, userID)
+		}
+	}
+	h.remoteMu.Unlock()
+
+	// Nobody is left to announce for a dead instance, so every survivor does;
+	// the duplicates all carry the same status
+	for _, userID := range expired {
+		var user models.User
+		if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+			continue
+		}
+		h.presenceMu.Lock()
+		h.announcePresence(&user, h.Presence(userID))
+		h.presenceMu.Unlock()
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+const maxEmojiLen = 64
+
+// validEmoji accepts a unicode emoji sequence or a :shortcode:, anything short
+// and free of whitespace
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiLen {
+		return false
+	}
+	return !strings.ContainsFunc(emoji, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+}
+
+// summarizeReactions groups reactions per message in the order each emoji was
+// first used, flagging the ones userID added
+func summarizeReactions(messageIDs []uuid.UUID, userID uuid.UUID) map[uuid.UUID][]gin.H {
+	summary := make(map[uuid.UUID][]gin.H)
+	if len(messageIDs) == 0 {
+		return summary
+	}
+
+	var rows []struct {
+		MessageID uuid.UUID
+		Emoji     string
+		Count     int64
+		ReactedBy bool
+	}
+	database.DB.Model(&models.Reaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted_by", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("MIN(created_at) ASC").
+		Scan(&rows)
+
+	for _, row := range rows {
+		summary[row.MessageID] = append(summary[row.MessageID], gin.H{
+			"emoji":         row.Emoji,
+			"count":         row.Count,
+			"reacted_by_me": row.ReactedBy,
+		})
+	}
+	return summary
+}
+
+func AddReaction(c *gin.Context) {
+	var input struct {
+		Emoji string `json:"emoji" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, 400, "Emoji is required")
+		return
+	}
+
+	setReaction(c, strings.TrimSpace(input.Emoji), true)
+}
+
+func RemoveReaction(c *gin.Context) {
+	setReaction(c, c.Param("emoji"), false)
+}
+
+func setReaction(c *gin.Context, emoji string, add bool) {
+	channelID := c.Param("id")
+	messageID := c.Param("messageId")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	if !utils.IsValidUUID(messageID) {
+		utils.ErrorResponse(c, 400, "Invalid message ID")
+		return
+	}
+
+	if !validEmoji(emoji) {
+		utils.ErrorResponse(c, 400, "Invalid emoji")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	// Taking a reaction back is always allowed
+	if add && !middleware.CanPost(user) {
+		utils.ErrorResponse(c, 403, errEmailUnverified.Error())
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	// Same gate as sending a message over the socket, though members can
+	// always remove their own reactions
+	role := memberRole(&channel, user.ID)
+	if role == "" {
+		utils.ErrorResponse(c, 403, "You must be a member to react in this channel")
+		return
+	}
+
+	if add && !models.RoleHasPermission(role, models.PermSendMessages) {
+		utils.ErrorResponse(c, 403, "You don't have permission to react in this channel")
+		return
+	}
+
+	var message models.Message
+	if err := database.DB.First(&message, "id = ? AND channel_id = ?", messageID, channel.ID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Message not found")
+		return
+	}
+
+	reaction := models.Reaction{
+		MessageID: message.ID,
+		UserID:    user.ID,
+		Emoji:     emoji,
+	}
+
+	var eventType string
+	if add {
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+		if result.Error != nil {
+			utils.ErrorResponse(c, 500, "Failed to add reaction")
+			return
+		}
+		if result.RowsAffected == 0 {
+			utils.ErrorResponse(c, 400, "You already reacted with this emoji")
+			return
+		}
+		eventType = "reaction_added"
+	} else {
+		result := database.DB.Delete(&reaction)
+		if result.Error != nil {
+			utils.ErrorResponse(c, 500, "Failed to remove reaction")
+			return
+		}
+		if result.RowsAffected == 0 {
+			utils.ErrorResponse(c, 404, "Reaction not found")
+			return
+		}
+		eventType = "reaction_removed"
+	}
+
+	publishToChannel(channel.ID, WSMessage{
+		Type:      eventType,
+		MessageID: message.ID.String(),
+		Emoji:     emoji,
+		User: map[string]any{
+			"id":       user.ID,
+			"username": user.Username,
+		},
+		Timestamp: time.Now(),
+	})
+
+	utils.SuccessResponse(c, 200, "Reaction updated successfully", gin.H{
+		"message_id": message.ID,
+		"reactions":  summarizeReactions([]uuid.UUID{message.ID}, user.ID)[message.ID],
+	})
+}
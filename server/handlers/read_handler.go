@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	errNotChannelMember = errors.New("You must be a member of this channel")
+	errMessageMissing   = errors.New("Message not found")
+)
+
+type unreadCount struct {
+	Unread   int64
+	Mentions int64
+}
+
+// unreadCounts tallies, per channel, top-level messages from other people past
+// the user's read pointer, and how many messages (replies included) mention them
+func unreadCounts(user *models.User, channelIDs []uuid.UUID) map[uuid.UUID]unreadCount {
+	counts := make(map[uuid.UUID]unreadCount)
+	if len(channelIDs) == 0 {
+		return counts
+	}
+
+	var rows []struct {
+		ChannelID    uuid.UUID
+		UnreadCount  int64
+		MentionCount int64
+	}
+	database.DB.Raw(`
+		SELECT channel_members.channel_id,
+			COUNT(*) FILTER (WHERE messages.parent_id IS NULL) AS unread_count,
+			COUNT(mentions.message_id) AS mention_count
+		FROM channel_members
+		JOIN messages ON messages.channel_id = channel_members.channel_id
+			AND messages.sequence > channel_members.last_read_seq
+			AND messages.user_id <> channel_members.user_id
+			AND messages.deleted_at IS NULL
+		LEFT JOIN mentions ON mentions.message_id = messages.id AND mentions.user_id = channel_members.user_id
+		WHERE channel_members.user_id = ? AND channel_members.channel_id IN ?
+		GROUP BY channel_members.channel_id
+	`, user.ID, channelIDs).Scan(&rows)
+
+	for _, row := range rows {
+		counts[row.ChannelID] = unreadCount{Unread: row.UnreadCount, Mentions: row.MentionCount}
+	}
+	return counts
+}
+
+// markRead moves the user's read pointer up to messageID, or to the newest
+// message when messageID is empty. The pointer never moves backwards; advanced
+// reports whether it moved at all.
+func markRead(channel *models.Channel, user *models.User, messageID string) (seq int64, advanced bool, err error) {
+	if !isChannelMember(channel.ID, user.ID) {
+		return 0, false, errNotChannelMember
+	}
+
+	seq = channel.LastSeq
+	if messageID != "" {
+		var message models.Message
+		if !utils.IsValidUUID(messageID) ||
+			database.DB.First(&message, "id = ? AND channel_id = ?", messageID, channel.ID).Error != nil {
+			return 0, false, errMessageMissing
+		}
+		seq = message.Sequence
+	}
+
+	result := database.DB.Model(&models.ChannelMember{}).
+		Where("channel_id = ? AND user_id = ? AND last_read_seq < ?", channel.ID, user.ID, seq).
+		UpdateColumns(map[string]any{
+			"last_read_seq": seq,
+			"last_read_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return 0, false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		// Already past it; report where the pointer actually is
+		var member models.ChannelMember
+		database.DB.First(&member, "channel_id = ? AND user_id = ?", channel.ID, user.ID)
+		return member.LastReadSeq, false, nil
+	}
+
+	return seq, true, nil
+}
+
+// readEvent tells the channel (including the reader's other tabs) how far a
+// user has read
+func readEvent(user *models.User, seq int64) WSMessage {
+	return WSMessage{
+		Type:     "read",
+		Sequence: seq,
+		User: map[string]any{
+			"id":       user.ID,
+			"username": user.Username,
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+func MarkChannelRead(c *gin.Context) {
+	channelID := c.Param("id")
+
+	if !utils.IsValidUUID(channelID) {
+		utils.ErrorResponse(c, 400, "Invalid channel ID")
+		return
+	}
+
+	var input struct {
+		MessageID string `json:"message_id"`
+	}
+
+	// The body is optional; without one the whole channel is marked read
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.ErrorResponse(c, 400, "Invalid input")
+			return
+		}
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		utils.ErrorResponse(c, 404, "Channel not found")
+		return
+	}
+
+	seq, advanced, err := markRead(&channel, user, input.MessageID)
+	switch {
+	case err == nil:
+	case errors.Is(err, errNotChannelMember):
+		utils.ErrorResponse(c, 403, err.Error())
+		return
+	case errors.Is(err, errMessageMissing):
+		utils.ErrorResponse(c, 404, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to mark channel as read")
+		return
+	}
+
+	if advanced {
+		publishToChannel(channel.ID, readEvent(user, seq))
+	}
+
+	utils.SuccessResponse(c, 200, "Channel marked as read", gin.H{
+		"channel_id":    channel.ID,
+		"last_read_seq": seq,
+	})
+}
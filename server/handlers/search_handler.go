@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ts_headline marks matches with control characters that can't appear in a
+// safe snippet, so the content can be escaped before the <mark> tags go in
+const (
+	highlightStart    = "\x02"
+	highlightStop     = "\x03"
+	headlineOptions   = "StartSel=\x02, StopSel=\x03, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+	searchTSConfig    = "english"
+	maxSearchQueryLen = 200
+)
+
+func highlightSnippet(raw string) string {
+	escaped := html.EscapeString(raw)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+func SearchMessages(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if utf8.RuneCountInString(q) < 2 {
+		utils.ErrorResponse(c, 400, "Search query must be at least 2 characters long")
+		return
+	}
+	if len(q) > maxSearchQueryLen {
+		utils.ErrorResponse(c, 400, "Search query must be less than 200 characters")
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	query := database.DB.Table("messages").
+		Select(`messages.id, messages.channel_id, messages.content, messages.sequence, messages.created_at,
+			users.id AS user_id, users.username, channels.name AS channel_name,
+			ts_headline(?, messages.content, websearch_to_tsquery(?, ?), ?) AS snippet`,
+			searchTSConfig, searchTSConfig, q, headlineOptions).
+		Joins("JOIN channels ON channels.id = messages.channel_id AND channels.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = messages.user_id").
+		Where("messages.deleted_at IS NULL").
+		Where("messages.search_vector @@ websearch_to_tsquery(?, ?)", searchTSConfig, q).
+		Where(`channels.access_type = 'public' OR EXISTS (
+			SELECT 1 FROM channel_members WHERE channel_members.channel_id = channels.id AND channel_members.user_id = ?
+		)`, user.ID)
+
+	if channelID := c.Query("channel_id"); channelID != "" {
+		if !utils.IsValidUUID(channelID) {
+			utils.ErrorResponse(c, 400, "Invalid channel ID")
+			return
+		}
+		query = query.Where("messages.channel_id = ?", channelID)
+	}
+
+	if author := c.Query("author"); author != "" {
+		query = query.Where("users.username = ?", author)
+	}
+
+	if from := c.Query("from"); from != "" {
+		fromTime, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			utils.ErrorResponse(c, 400, "from must be an RFC3339 timestamp")
+			return
+		}
+		query = query.Where("messages.created_at >= ?", fromTime)
+	}
+
+	if to := c.Query("to"); to != "" {
+		toTime, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			utils.ErrorResponse(c, 400, "to must be an RFC3339 timestamp")
+			return
+		}
+		query = query.Where("messages.created_at < ?", toTime)
+	}
+
+	// Results are newest first; the cursor is the last message ID of the previous page
+	if cursor := c.Query("cursor"); cursor != "" {
+		if !utils.IsValidUUID(cursor) {
+			utils.ErrorResponse(c, 400, "Invalid cursor")
+			return
+		}
+
+		var cursorMsg models.Message
+		if err := database.DB.First(&cursorMsg, "id = ?", cursor).Error; err == nil {
+			query = query.Where("(messages.created_at, messages.id) < (?, ?)", cursorMsg.CreatedAt, cursorMsg.ID)
+		}
+	}
+
+	var rows []struct {
+		ID          uuid.UUID
+		ChannelID   uuid.UUID
+		ChannelName string
+		Content     string
+		Sequence    int64
+		CreatedAt   time.Time
+		UserID      uuid.UUID
+		Username    string
+		Snippet     string
+	}
+
+	err := query.
+		Order("messages.created_at DESC, messages.id DESC").
+		Limit(limit + 1).
+		Scan(&rows).Error
+
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to search messages")
+		return
+	}
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	results := []gin.H{}
+	for _, row := range rows {
+		results = append(results, gin.H{
+			"id":         row.ID,
+			"content":    row.Content,
+			"snippet":    highlightSnippet(row.Snippet),
+			"sequence":   row.Sequence,
+			"created_at": row.CreatedAt,
+			"channel": gin.H{
+				"id":   row.ChannelID,
+				"name": row.ChannelName,
+			},
+			"user": gin.H{
+				"id":       row.UserID,
+				"username": row.Username,
+			},
+		})
+	}
+
+	var nextCursor *string
+	if hasMore {
+		last := rows[len(rows)-1].ID.String()
+		nextCursor = &last
+	}
+
+	utils.SuccessResponse(c, 200, "Search results fetched successfully", gin.H{
+		"results":     results,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	})
+}
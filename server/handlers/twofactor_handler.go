@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer        = "Vyenet"
+	recoveryCodeCount = 10
+)
+
+var (
+	errTwoFactorCode       = errors.New("Invalid authentication code")
+	errTwoFactorNotEnabled = errors.New("Two-factor authentication is not enabled")
+)
+
+// checkTOTP accepts a code at most once: the matching time step has to be
+// newer than the last one used, and recording it is a conditional update so
+// two requests racing with the same code can't both win
+func checkTOTP(tx *gorm.DB, user *models.User, code string) error {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return errTwoFactorCode
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errTwoFactorCode
+	}
+
+	user.TOTPLastStep = step
+	return nil
+}
+
+// useRecoveryCode spends one of the user's unused recovery codes
+func useRecoveryCode(tx *gorm.DB, userID uuid.UUID, code string) error {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errTwoFactorCode
+	}
+	return nil
+}
+
+// checkSecondFactor takes either an authenticator code or a recovery code
+func checkSecondFactor(tx *gorm.DB, user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return errTwoFactorNotEnabled
+	}
+	if err := checkTOTP(tx, user, code); !errors.Is(err, errTwoFactorCode) {
+		return err
+	}
+	return useRecoveryCode(tx, user.ID, code)
+}
+
+// replaceRecoveryCodes drops any previous codes and returns a fresh set in
+// plaintext; this is the only time the user gets to see them
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			ID:       uuid.New(),
+			UserID:   userID,
+			CodeHash: utils.HashToken(code),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func SetupTwoFactor(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	if user.TOTPEnabled {
+		utils.ErrorResponse(c, 400, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.ErrorResponse(c, 500, "Failed to set up two-factor authentication")
+		return
+	}
+
+	// Stored but not enabled until the user proves their app has it
+	if err := database.DB.Model(user).Updates(map[string]any{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		utils.ErrorResponse(c, 500, "Failed to set up two-factor authentication")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Scan the code with your authenticator app, then confirm", gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+func ConfirmTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	if user.TOTPEnabled {
+		utils.ErrorResponse(c, 400, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		utils.ErrorResponse(c, 400, "Start two-factor setup first")
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkTOTP(tx, user, input.Code); err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errTwoFactorCode):
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to enable two-factor authentication")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Two-factor authentication enabled", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		utils.ErrorResponse(c, 401, "Invalid password")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, user, input.Code); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(user).Updates(map[string]any{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errTwoFactorCode), errors.Is(err, errTwoFactorNotEnabled):
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to disable two-factor authentication")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Two-factor authentication disabled", nil)
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	if !user.TOTPEnabled {
+		utils.ErrorResponse(c, 400, errTwoFactorNotEnabled.Error())
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the authenticator will do here; a recovery code can't mint more
+		if err := checkTOTP(tx, user, input.Code); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errTwoFactorCode):
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to regenerate recovery codes")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Recovery codes regenerated", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// VerifyTwoFactorLogin is the second step of logging in for accounts with
+// two-factor enabled. It takes an authenticator or recovery code.
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	userID, ok := middleware.PendingTwoFactorUser(c)
+	if !ok {
+		utils.ErrorResponse(c, 401, "Your login has expired, please sign in again")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		utils.ErrorResponse(c, 401, "Your login has expired, please sign in again")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return checkSecondFactor(tx, &user, input.Code)
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errTwoFactorCode):
+		locked, saveErr := middleware.FailTwoFactor(c)
+		if saveErr != nil {
+			utils.ErrorResponse(c, 500, "Failed to verify code")
+			return
+		}
+		if locked {
+			utils.ErrorResponse(c, 401, "Too many invalid codes, please sign in again")
+			return
+		}
+		utils.ErrorResponse(c, 401, err.Error())
+		return
+	case errors.Is(err, errTwoFactorNotEnabled):
+		// Disabled since the password step; nothing left to check
+	default:
+		utils.ErrorResponse(c, 500, "Failed to verify code")
+		return
+	}
+
+	if err := middleware.CompleteTwoFactor(c); err != nil {
+		utils.ErrorResponse(c, 500, "Failed to create session")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Login successful", gin.H{
+		"user": gin.H{
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
+		},
+	})
+}
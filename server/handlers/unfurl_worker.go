@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/markup"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/unfurl"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxEmbedsPerMessage = 3
+	unfurlWorkers       = 4
+	unfurlQueueSize     = 256
+	unfurlTimeout       = 15 * time.Second
+)
+
+type unfurlJob struct {
+	MessageID uuid.UUID
+	ChannelID uuid.UUID
+	Content   string
+
+	// Edits replace whatever previews the old content had, even with none
+	Replace bool
+}
+
+var (
+	unfurlQueue    chan unfurlJob
+	errStaleUnfurl = errors.New("message changed while unfurling")
+)
+
+// StartUnfurler runs the workers that add link previews to saved messages
+func StartUnfurler(fetcher *unfurl.Fetcher) {
+	unfurlQueue = make(chan unfurlJob, unfurlQueueSize)
+	for range unfurlWorkers {
+		go func() {
+			for job := range unfurlQueue {
+				runUnfurl(fetcher, job)
+			}
+		}()
+	}
+}
+
+// enqueueUnfurl never blocks the sender; when the workers are swamped the
+// message simply goes without a preview
+func enqueueUnfurl(message models.Message, replace bool) {
+	if unfurlQueue == nil {
+		return
+	}
+
+	job := unfurlJob{
+		MessageID: message.ID,
+		ChannelID: message.ChannelID,
+		Content:   message.Content,
+		Replace:   replace,
+	}
+	if !replace && len(extractURLs(job.Content)) == 0 {
+		return
+	}
+
+	select {
+	case unfurlQueue <- job:
+	default:
+		log.Printf("Unfurl queue full, skipping previews for message %s", message.ID)
+	}
+}
+
+// extractURLs takes links from the formatted message, so URLs inside code
+// spans and blocks are left alone
+func extractURLs(content string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+
+	var walk func(tokens []markup.Token)
+	walk = func(tokens []markup.Token) {
+		for _, token := range tokens {
+			if len(urls) >= maxEmbedsPerMessage {
+				return
+			}
+			if token.Type == markup.TypeLink {
+				if !seen[token.URL] && strings.HasPrefix(token.URL, "http") {
+					seen[token.URL] = true
+					urls = append(urls, token.URL)
+				}
+				continue
+			}
+			walk(token.Children)
+		}
+	}
+	walk(markup.Parse(content))
+
+	return urls
+}
+
+func runUnfurl(fetcher *unfurl.Fetcher, job unfurlJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), unfurlTimeout)
+	defer cancel()
+
+	var embeds []models.MessageEmbed
+	for i, url := range extractURLs(job.Content) {
+		embed, err := fetcher.Fetch(ctx, url)
+		if err != nil {
+			continue
+		}
+		embeds = append(embeds, models.MessageEmbed{
+			ID:          uuid.New(),
+			MessageID:   job.MessageID,
+			Position:    i,
+			URL:         embed.URL,
+			Title:       embed.Title,
+			Description: embed.Description,
+			ImageURL:    embed.ImageURL,
+			SiteName:    embed.SiteName,
+		})
+	}
+
+	if len(embeds) == 0 && !job.Replace {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// The message may have been edited again or deleted while we fetched
+		var message models.Message
+		if err := tx.First(&message, "id = ?", job.MessageID).Error; err != nil {
+			return err
+		}
+		if message.Content != job.Content {
+			return errStaleUnfurl
+		}
+
+		if err := tx.Where("message_id = ?", job.MessageID).Delete(&models.MessageEmbed{}).Error; err != nil {
+			return err
+		}
+		if len(embeds) == 0 {
+			return nil
+		}
+		return tx.Create(&embeds).Error
+	})
+	if err != nil {
+		if !errors.Is(err, errStaleUnfurl) && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to save previews for message %s: %v", job.MessageID, err)
+		}
+		return
+	}
+
+	publishToChannel(job.ChannelID, WSMessage{
+		Type:      "message_embed",
+		MessageID: job.MessageID.String(),
+		Embeds:    embedsResponse(embeds),
+		Timestamp: time.Now(),
+	})
+}
+
+func orderEmbeds(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC")
+}
+
+func embedsResponse(embeds []models.MessageEmbed) []unfurl.Embed {
+	response := []unfurl.Embed{}
+	for _, embed := range embeds {
+		response = append(response, unfurl.Embed{
+			URL:         embed.URL,
+			Title:       embed.Title,
+			Description: embed.Description,
+			ImageURL:    embed.ImageURL,
+			SiteName:    embed.SiteName,
+		})
+	}
+	return response
+}
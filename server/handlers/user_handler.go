@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"log"
+
 	"github.com/RudraPatel5435/vyenet/server/database"
 	"github.com/RudraPatel5435/vyenet/server/middleware"
 	"github.com/RudraPatel5435/vyenet/server/models"
@@ -57,16 +59,22 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
-	if err := middleware.SetUserSession(c, user.ID); err != nil {
+	// The account is usable without it; the user can ask for another email
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+
+	if err := middleware.SetUserSession(c, &user); err != nil {
 		utils.ErrorResponse(c, 500, "Failed to create session")
 		return
 	}
 
 	utils.SuccessResponse(c, 201, "User registered successfully", gin.H{
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
 		},
 	})
 }
@@ -95,16 +103,31 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	if err := middleware.SetUserSession(c, user.ID); err != nil {
+	// The password alone only gets a half-authenticated session; the code
+	// goes to /user/login/2fa
+	if user.TOTPEnabled {
+		if err := middleware.SetPendingTwoFactor(c, &user); err != nil {
+			utils.ErrorResponse(c, 500, "Failed to create session")
+			return
+		}
+
+		utils.SuccessResponse(c, 200, "Two-factor authentication required", gin.H{
+			"two_factor_required": true,
+		})
+		return
+	}
+
+	if err := middleware.SetUserSession(c, &user); err != nil {
 		utils.ErrorResponse(c, 500, "Failed to create session")
 		return
 	}
 
 	utils.SuccessResponse(c, 200, "Login successful", gin.H{
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
 		},
 	})
 }
@@ -126,9 +149,11 @@ func GetMe(c *gin.Context) {
 	}
 
 	utils.SuccessResponse(c, 200, "User profile fetched", gin.H{
-		"id":       user.ID,
-		"username": user.Username,
-		"email":    user.Email,
+		"id":                 user.ID,
+		"username":           user.Username,
+		"email":              user.Email,
+		"email_verified":     user.EmailVerified,
+		"two_factor_enabled": user.TOTPEnabled,
 		// "last_online": user.LastOnline,
 		// "created_at":  user.CreatedAt,
 	})
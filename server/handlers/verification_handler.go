@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/mailer"
+	"github.com/RudraPatel5435/vyenet/server/middleware"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerifyTTL           = 24 * time.Hour
+	verificationResendWindow = time.Minute
+)
+
+var errEmailUnverified = errors.New("Please verify your email address before posting")
+
+func sendVerificationEmail(user *models.User) error {
+	token, err := issueUserToken(database.DB, user.ID, models.TokenEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email for Vyenet",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to Vyenet! Confirm this is your email address by opening:\n\n%s\n\n"+
+			"The link works for 24 hours. If you didn't sign up, you can ignore this email.\n",
+			user.Username, appLink("/verify-email", token)),
+	})
+	return nil
+}
+
+func VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		record, err := consumeUserToken(tx, input.Token, models.TokenEmailVerify)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ?", record.UserID).
+			Update("email_verified", true).Error
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errTokenInvalid), errors.Is(err, errTokenExpired):
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, 500, "Failed to verify email")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Email verified successfully", nil)
+}
+
+func ResendVerification(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		utils.ErrorResponse(c, 401, "User not authenticated")
+		return
+	}
+
+	if user.EmailVerified {
+		utils.ErrorResponse(c, 400, "Your email is already verified")
+		return
+	}
+
+	var last models.UserToken
+	err := database.DB.
+		Where("user_id = ? AND purpose = ?", user.ID, models.TokenEmailVerify).
+		Order("created_at DESC").
+		First(&last).Error
+	if err == nil {
+		if wait := verificationResendWindow - time.Since(last.CreatedAt); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			utils.ErrorResponse(c, 429, "Please wait a minute before requesting another email")
+			return
+		}
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		utils.ErrorResponse(c, 500, "Failed to send verification email")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, "Verification email sent", nil)
+}
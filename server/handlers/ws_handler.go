@@ -1,62 +1,265 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/markup"
 	"github.com/RudraPatel5435/vyenet/server/middleware"
 	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/pubsub"
+	"github.com/RudraPatel5435/vyenet/server/unfurl"
 	"github.com/RudraPatel5435/vyenet/server/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// Client is a single WebSocket connection. It may be subscribed to any number
+// of channels; the legacy /ws/:channelId endpoint subscribes it to one.
 type Client struct {
-	Conn      *websocket.Conn
-	User      *models.User
+	ID   uuid.UUID
+	Conn *websocket.Conn
+	User *models.User
+	Send chan []byte
+
+	// DefaultChannelID is used for frames that omit channel_id
+	DefaultChannelID uuid.UUID
+
+	// Set when the connection authenticated with an API token; a token
+	// without the write scope may only subscribe and listen
+	tokenID  uuid.UUID
+	readOnly bool
+
+	// Guarded by Hub.Mutex
+	subscriptions map[uuid.UUID]*Subscription
+	status        string
+
+	// Send is never closed; closing done tells WritePump to hang up instead,
+	// so late writers can't panic
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Per-connection flood limits, only touched by ReadPump
+	frameLimit   *middleware.TokenBucket
+	messageLimit *middleware.TokenBucket
+	typingLimit  *middleware.TokenBucket
+	strikes      int
+}
+
+// Subscription is a client's membership in one channel's fan-out
+type Subscription struct {
+	Client    *Client
 	ChannelID uuid.UUID
-	Send      chan []byte
 	IsMember  bool
+
+	// While replaying, live events queue in pending so they can't overtake
+	// the messages being read back from the database
+	replaying bool
+	resumeSeq int64
+	pending   []hubEvent
 }
 
+const (
+	replayPageSize   = 200
+	maxReplay        = 1000
+	maxPendingEvents = 1024
+	maxSubscriptions = 100
+
+	// A client that keeps sending after this many rate-limit errors in a row
+	// is disconnected
+	maxRateLimitStrikes = 20
+)
+
+var (
+	errPrivateChannel = errors.New("You must be a member of this private channel")
+	errNotSubscribed  = errors.New("You are not subscribed to this channel")
+)
+
 type Hub struct {
+	Clients map[*Client]bool
+
 	Channels map[uuid.UUID]map[*Client]bool
 
 	Register chan *Client
 
 	Unregister chan *Client
 
+	Subscribe chan *Subscription
+
+	Unsubscribe chan *Subscription
+
 	Broadcast chan *BroadcastMessage
 
+	// Broker carries broadcasts between server instances; local clients are
+	// only ever written to from what comes back out of it
+	Broker pubsub.Broker
+
 	Mutex sync.RWMutex
+
+	// Guarded by Mutex; every connection a user has open on this instance
+	userClients map[uuid.UUID]map[*Client]bool
+
+	// InstanceID tells this instance's presence reports apart from the others'
+	InstanceID uuid.UUID
+
+	// Last status broadcast per user
+	presenceMu sync.Mutex
+	announced  map[uuid.UUID]string
+
+	// Statuses reported by other instances, per user and then per instance
+	remoteMu       sync.RWMutex
+	remotePresence map[uuid.UUID]map[uuid.UUID]remoteStatus
 }
 
+// hubEvent is the envelope published through the Broker
+type hubEvent struct {
+	ChannelID uuid.UUID       `json:"channel_id"`
+	Sequence  int64           `json:"sequence,omitempty"`
+	ExcludeID uuid.UUID       `json:"exclude_id,omitempty"`
+	UserID    uuid.UUID       `json:"user_id,omitempty"` // set for events addressed to one user
+	Control   string          `json:"control,omitempty"`
+	Data      json.RawMessage `json:"data"`
+
+	// Presence reports: the sending instance and its users' local statuses
+	Instance uuid.UUID            `json:"instance,omitempty"`
+	Presence map[uuid.UUID]string `json:"presence,omitempty"`
+}
+
+// Control events change subscriptions on every instance instead of carrying
+// a frame for clients
+const (
+	controlGrantMember      = "grant_member"       // UserID joined ChannelID
+	controlRevokeUser       = "revoke_user"        // UserID lost access to ChannelID
+	controlRevokeNonMembers = "revoke_non_members" // ChannelID became members-only
+	controlPresence         = "presence"           // Instance's view of some users' statuses
+)
+
 type BroadcastMessage struct {
 	ChannelID uuid.UUID
+	Sequence  int64
 	Data      []byte
 }
 
 var hub = &Hub{
-	Channels:   make(map[uuid.UUID]map[*Client]bool),
-	Register:   make(chan *Client),
-	Unregister: make(chan *Client),
-	Broadcast:  make(chan *BroadcastMessage),
+	Clients:        make(map[*Client]bool),
+	Channels:       make(map[uuid.UUID]map[*Client]bool),
+	Register:       make(chan *Client),
+	Unregister:     make(chan *Client),
+	Subscribe:      make(chan *Subscription),
+	Unsubscribe:    make(chan *Subscription),
+	Broadcast:      make(chan *BroadcastMessage),
+	userClients:    make(map[uuid.UUID]map[*Client]bool),
+	InstanceID:     uuid.New(),
+	announced:      make(map[uuid.UUID]string),
+	remotePresence: make(map[uuid.UUID]map[uuid.UUID]remoteStatus),
 }
 
 type WSMessage struct {
-	Type      string         `json:"type"` // "message", "typing", "user_joined", "user_left"
-	Content   string         `json:"content,omitempty"`
-	MessageID string         `json:"message_id,omitempty"`
-	User      map[string]any `json:"user"`
-	Timestamp time.Time      `json:"timestamp"`
+	Type         string         `json:"type"` // "message", "message_edited", "message_deleted", "message_pinned", "message_unpinned", "reaction_added", "reaction_removed", "member_added", "member_removed", "system", "thread_reply", "typing", "read", "presence_update", "mention", "message_embed", "user_joined", "user_left", "subscribed", "unsubscribed", "replay_complete", "resync_required", "error"
+	ChannelID    string         `json:"channel_id,omitempty"`
+	Content      string         `json:"content,omitempty"`
+	Tokens       []markup.Token `json:"tokens,omitempty"`
+	MessageID    string         `json:"message_id,omitempty"`
+	ParentID     string         `json:"parent_id,omitempty"`
+	Emoji        string         `json:"emoji,omitempty"`
+	Status       string         `json:"status,omitempty"`
+	Sequence     int64          `json:"sequence,omitempty"`
+	Attachments  []gin.H        `json:"attachments,omitempty"`
+	Embeds       []unfurl.Embed `json:"embeds,omitempty"`
+	RetryAfterMs int64          `json:"retry_after_ms,omitempty"`
+	User         map[string]any `json:"user"`
+	Timestamp    time.Time      `json:"timestamp"`
+}
+
+// publishToChannel marshals msg and fans it out to every client in the channel
+func publishToChannel(channelID uuid.UUID, msg WSMessage) {
+	msg.ChannelID = channelID.String()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", msg.Type, err)
+		return
+	}
+	hub.BroadcastToChannel(channelID, data, nil)
+}
+
+// publishToUser sends msg to every connection the user has open, whether or
+// not they are subscribed to msg's channel
+func publishToUser(userID uuid.UUID, msg WSMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", msg.Type, err)
+		return
+	}
+	hub.publish(hubEvent{
+		UserID: userID,
+		Data:   data,
+	})
+}
+
+// grantChannelMembership marks userID's existing subscriptions to channelID as
+// a member's, so someone who joins while watching can type straight away
+func grantChannelMembership(channelID, userID uuid.UUID) {
+	hub.publish(hubEvent{
+		Control:   controlGrantMember,
+		ChannelID: channelID,
+		UserID:    userID,
+	})
 }
 
-func StartHub() {
+// revokeChannelAccess drops every subscription userID holds on channelID,
+// after they are kicked or leave
+func revokeChannelAccess(channelID, userID uuid.UUID) {
+	hub.publish(hubEvent{
+		Control:   controlRevokeUser,
+		ChannelID: channelID,
+		UserID:    userID,
+	})
+}
+
+// restrictChannelToMembers drops the subscriptions of non-members watching a
+// channel that has just gone private
+func restrictChannelToMembers(channelID uuid.UUID) {
+	hub.publish(hubEvent{
+		Control:   controlRevokeNonMembers,
+		ChannelID: channelID,
+	})
+}
+
+func StartHub(broker pubsub.Broker) {
+	hub.Broker = broker
+
+	events, err := broker.Subscribe(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to subscribe hub to broker: %v", err)
+	}
+
+	go hub.Consume(events)
 	go hub.Run()
+
+	go func() {
+		for range time.Tick(presenceSyncInterval) {
+			hub.syncPresence()
+		}
+	}()
+}
+
+// Consume delivers broker events to the clients connected to this instance
+func (h *Hub) Consume(events <-chan []byte) {
+	for payload := range events {
+		var event hubEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			log.Printf("Failed to parse hub event: %v", err)
+			continue
+		}
+		h.deliver(event)
+	}
 }
 
 func (h *Hub) Run() {
@@ -64,75 +267,523 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.Register:
 			h.Mutex.Lock()
-			if h.Channels[client.ChannelID] == nil {
-				h.Channels[client.ChannelID] = make(map[*Client]bool)
+			h.Clients[client] = true
+			if h.userClients[client.User.ID] == nil {
+				h.userClients[client.User.ID] = make(map[*Client]bool)
 			}
-			h.Channels[client.ChannelID][client] = true
+			h.userClients[client.User.ID][client] = true
 			h.Mutex.Unlock()
 
-			joinMsg := WSMessage{
-				Type: "user_joined",
-				User: map[string]any{
-					"id":       client.User.ID,
-					"username": client.User.Username,
-				},
-				Timestamp: time.Now(),
-			}
-			data, _ := json.Marshal(joinMsg)
-			h.BroadcastToChannel(client.ChannelID, data, client)
-
-			log.Printf("User %s joined channel %s", client.User.Username, client.ChannelID)
+			go h.refreshPresence(client.User)
 
 		case client := <-h.Unregister:
 			h.Mutex.Lock()
-			if clients, ok := h.Channels[client.ChannelID]; ok {
-				if _, ok := clients[client]; ok {
-					delete(clients, client)
-					close(client.Send)
-
-					if len(clients) == 0 {
-						delete(h.Channels, client.ChannelID)
-					}
+			delete(h.Clients, client)
+			if clients, ok := h.userClients[client.User.ID]; ok {
+				delete(clients, client)
+				if len(clients) == 0 {
+					delete(h.userClients, client.User.ID)
 				}
 			}
+			var left []uuid.UUID
+			for channelID := range client.subscriptions {
+				h.removeSubscription(client, channelID)
+				left = append(left, channelID)
+			}
 			h.Mutex.Unlock()
 
-			leaveMsg := WSMessage{
-				Type: "user_left",
-				User: map[string]any{
-					"id":       client.User.ID,
-					"username": client.User.Username,
-				},
+			client.close()
+
+			for _, channelID := range left {
+				h.announce(client, channelID, "user_left", nil)
+			}
+
+			go h.refreshPresence(client.User)
+
+		case sub := <-h.Subscribe:
+			client := sub.Client
+
+			h.Mutex.Lock()
+			if !h.Clients[client] {
+				h.Mutex.Unlock()
+				continue
+			}
+			if _, ok := client.subscriptions[sub.ChannelID]; ok {
+				h.Mutex.Unlock()
+				client.sendError(sub.ChannelID, "You are already subscribed to this channel")
+				continue
+			}
+			if len(client.subscriptions) >= maxSubscriptions {
+				h.Mutex.Unlock()
+				client.sendError(sub.ChannelID, "Too many channel subscriptions on this connection")
+				continue
+			}
+			if h.Channels[sub.ChannelID] == nil {
+				h.Channels[sub.ChannelID] = make(map[*Client]bool)
+			}
+			h.Channels[sub.ChannelID][client] = true
+			client.subscriptions[sub.ChannelID] = sub
+			h.Mutex.Unlock()
+
+			client.sendFrame(WSMessage{
+				Type:      "subscribed",
+				ChannelID: sub.ChannelID.String(),
 				Timestamp: time.Now(),
+			})
+
+			// Only start reading history once live events are being queued,
+			// otherwise a message committed in between would be lost
+			if sub.replaying {
+				go sub.Replay()
+			}
+
+			h.announce(client, sub.ChannelID, "user_joined", client)
+
+		case sub := <-h.Unsubscribe:
+			client := sub.Client
+
+			h.Mutex.Lock()
+			_, ok := client.subscriptions[sub.ChannelID]
+			if ok {
+				h.removeSubscription(client, sub.ChannelID)
+			}
+			h.Mutex.Unlock()
+
+			if !ok {
+				client.sendError(sub.ChannelID, errNotSubscribed.Error())
+				continue
 			}
-			data, _ := json.Marshal(leaveMsg)
-			h.BroadcastToChannel(client.ChannelID, data, nil)
 
-			log.Printf("User %s left channel %s", client.User.Username, client.ChannelID)
+			client.sendFrame(WSMessage{
+				Type:      "unsubscribed",
+				ChannelID: sub.ChannelID.String(),
+				Timestamp: time.Now(),
+			})
+			h.announce(client, sub.ChannelID, "user_left", nil)
 
 		case message := <-h.Broadcast:
-			h.BroadcastToChannel(message.ChannelID, message.Data, nil)
+			h.publish(hubEvent{
+				ChannelID: message.ChannelID,
+				Sequence:  message.Sequence,
+				Data:      message.Data,
+			})
 		}
 	}
 }
 
+// removeSubscription must be called with h.Mutex held
+func (h *Hub) removeSubscription(client *Client, channelID uuid.UUID) {
+	delete(client.subscriptions, channelID)
+	if clients, ok := h.Channels[channelID]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.Channels, channelID)
+		}
+	}
+}
+
+func (h *Hub) announce(client *Client, channelID uuid.UUID, eventType string, exclude *Client) {
+	msg := WSMessage{
+		Type:      eventType,
+		ChannelID: channelID.String(),
+		User: map[string]any{
+			"id":       client.User.ID,
+			"username": client.User.Username,
+		},
+		Timestamp: time.Now(),
+	}
+	data, _ := json.Marshal(msg)
+	h.BroadcastToChannel(channelID, data, exclude)
+
+	log.Printf("User %s %s channel %s", client.User.Username, eventType, channelID)
+}
+
 func (h *Hub) BroadcastToChannel(channelID uuid.UUID, data []byte, exclude *Client) {
+	event := hubEvent{
+		ChannelID: channelID,
+		Data:      data,
+	}
+	if exclude != nil {
+		event.ExcludeID = exclude.ID
+	}
+	h.publish(event)
+}
+
+func (h *Hub) publish(event hubEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal hub event: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.Broker.Publish(ctx, payload); err != nil {
+		// Other instances miss this one, but local clients still get it
+		log.Printf("Failed to publish hub event: %v", err)
+		h.deliver(event)
+	}
+}
+
+// deliver routes an event to one user's connections when it is addressed to
+// them, otherwise to everyone subscribed to its channel
+func (h *Hub) deliver(event hubEvent) {
+	if event.Control != "" {
+		h.applyControl(event)
+		return
+	}
+	if event.UserID != uuid.Nil {
+		h.deliverToUser(event)
+		return
+	}
+	h.deliverToChannel(event)
+}
+
+// applyControl removes the subscriptions a control event revokes and tells
+// the affected clients
+func (h *Hub) applyControl(event hubEvent) {
+	if event.Control == controlPresence {
+		h.mergeRemotePresence(event)
+		return
+	}
+
+	h.Mutex.Lock()
+	if event.Control == controlGrantMember {
+		for client := range h.userClients[event.UserID] {
+			if sub := client.subscriptions[event.ChannelID]; sub != nil {
+				sub.IsMember = true
+			}
+		}
+		h.Mutex.Unlock()
+		return
+	}
+
+	var dropped []*Client
+	for client := range h.Channels[event.ChannelID] {
+		switch event.Control {
+		case controlRevokeUser:
+			if client.User.ID != event.UserID {
+				continue
+			}
+		case controlRevokeNonMembers:
+			if client.subscriptions[event.ChannelID].IsMember {
+				continue
+			}
+		default:
+			continue
+		}
+		h.removeSubscription(client, event.ChannelID)
+		dropped = append(dropped, client)
+	}
+	h.Mutex.Unlock()
+
+	for _, client := range dropped {
+		client.sendFrame(WSMessage{
+			Type:      "unsubscribed",
+			ChannelID: event.ChannelID.String(),
+			Content:   "You no longer have access to this channel",
+			Timestamp: time.Now(),
+		})
+		h.announce(client, event.ChannelID, "user_left", nil)
+	}
+}
+
+func (h *Hub) deliverToUser(event hubEvent) {
 	h.Mutex.RLock()
-	clients := h.Channels[channelID]
-	h.Mutex.RUnlock()
-
-	for client := range clients {
-		if client != exclude {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				h.Mutex.Lock()
-				delete(h.Channels[channelID], client)
-				h.Mutex.Unlock()
+	defer h.Mutex.RUnlock()
+
+	for client := range h.userClients[event.UserID] {
+		if !client.trySend(event.Data) {
+			client.close()
+		}
+	}
+}
+
+func (h *Hub) deliverToChannel(event hubEvent) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	for client := range h.Channels[event.ChannelID] {
+		if event.ExcludeID != uuid.Nil && client.ID == event.ExcludeID {
+			continue
+		}
+
+		sub := client.subscriptions[event.ChannelID]
+		if sub.replaying {
+			if len(sub.pending) < maxPendingEvents {
+				sub.pending = append(sub.pending, event)
+			} else {
+				client.close()
+			}
+			continue
+		}
+
+		if !client.trySend(event.Data) {
+			// Drop clients that can't keep up; they resume with since= on reconnect
+			client.close()
+		}
+	}
+}
+
+// finishReplay hands queued live events to the client's Send buffer, skipping
+// messages the replay already covered
+func (h *Hub) finishReplay(sub *Subscription, lastSeq int64) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	pending := sub.pending
+	sub.pending = nil
+	sub.replaying = false
+
+	// Access was revoked while replaying; the queued events aren't theirs to see
+	if sub.Client.subscriptions[sub.ChannelID] != sub {
+		return
+	}
+
+	for _, event := range pending {
+		if event.Sequence > 0 && event.Sequence <= lastSeq {
+			continue
+		}
+
+		if !sub.Client.trySend(event.Data) {
+			sub.Client.close()
+			return
+		}
+	}
+}
+
+func newClient(conn *websocket.Conn, user *models.User, token *models.APIToken) *Client {
+	client := &Client{
+		ID:            uuid.New(),
+		Conn:          conn,
+		User:          user,
+		Send:          make(chan []byte, 256),
+		subscriptions: make(map[uuid.UUID]*Subscription),
+		status:        PresenceOnline,
+		done:          make(chan struct{}),
+		frameLimit:    middleware.NewTokenBucket(50*time.Millisecond, 40),
+		messageLimit:  middleware.NewTokenBucket(500*time.Millisecond, 10),
+		typingLimit:   middleware.NewTokenBucket(2*time.Second, 3),
+	}
+
+	if token != nil {
+		client.tokenID = token.ID
+		client.readOnly = !token.HasScope(models.ScopeWrite)
+	}
+
+	return client
+}
+
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// trySend queues data without blocking and reports whether it was accepted
+func (c *Client) trySend(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.Send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendWait queues data, waiting briefly for room in the buffer
+func (c *Client) sendWait(data []byte) bool {
+	select {
+	case c.Send <- data:
+		return true
+	case <-c.done:
+		return false
+	case <-time.After(10 * time.Second):
+		return false
+	}
+}
+
+func (c *Client) sendFrame(msg WSMessage) {
+	data, _ := json.Marshal(msg)
+	c.trySend(data)
+}
+
+func (c *Client) sendError(channelID uuid.UUID, content string) {
+	msg := WSMessage{
+		Type:      "error",
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+	if channelID != uuid.Nil {
+		msg.ChannelID = channelID.String()
+	}
+	c.sendFrame(msg)
+}
+
+// allow spends from bucket, telling the client when to retry if it's empty.
+// It reports false when the frame should be dropped.
+func (c *Client) allow(bucket *middleware.TokenBucket, channelID uuid.UUID) bool {
+	ok, wait := bucket.Take()
+	if ok {
+		c.strikes = 0
+		return true
+	}
+
+	c.strikes++
+	if c.strikes > maxRateLimitStrikes {
+		c.close()
+		return false
+	}
+
+	msg := WSMessage{
+		Type:         "error",
+		Content:      "You are sending too fast, please slow down",
+		RetryAfterMs: wait.Milliseconds() + 1,
+		Timestamp:    time.Now(),
+	}
+	if channelID != uuid.Nil {
+		msg.ChannelID = channelID.String()
+	}
+	c.sendFrame(msg)
+	return false
+}
+
+func (c *Client) subscription(channelID uuid.UUID) *Subscription {
+	hub.Mutex.RLock()
+	defer hub.Mutex.RUnlock()
+	return c.subscriptions[channelID]
+}
+
+// memberSubscription returns the client's subscription to channelID if it
+// was made, or has since been marked, as a member's
+func (c *Client) memberSubscription(channelID uuid.UUID) *Subscription {
+	hub.Mutex.RLock()
+	defer hub.Mutex.RUnlock()
+	if sub := c.subscriptions[channelID]; sub != nil && sub.IsMember {
+		return sub
+	}
+	return nil
+}
+
+// authorizeChannel applies the same access rules REST uses: anyone may watch a
+// public channel, only members may watch a private one
+func authorizeChannel(user *models.User, channelID uuid.UUID) (bool, error) {
+	var channel models.Channel
+	if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+		return false, errChannelMissing
+	}
+
+	isMember := memberRole(&channel, user.ID) != ""
+	if channel.IsMembersOnly() && !isMember {
+		return false, errPrivateChannel
+	}
+	return isMember, nil
+}
+
+func newSubscription(client *Client, channelID uuid.UUID, isMember bool, since *int64) *Subscription {
+	sub := &Subscription{
+		Client:    client,
+		ChannelID: channelID,
+		IsMember:  isMember,
+	}
+	if since != nil {
+		sub.replaying = true
+		sub.resumeSeq = *since
+	}
+	return sub
+}
+
+// Replay queues messages after resumeSeq for the client, then switches the
+// subscription over to live fan-out
+func (s *Subscription) Replay() {
+	lastSeq := s.resumeSeq
+	replayed := 0
+
+	for replayed < maxReplay {
+		if s.Client.subscription(s.ChannelID) != s {
+			// Unsubscribed or lost access part way through
+			break
+		}
+
+		var messages []models.Message
+		err := database.DB.
+			Preload("User").
+			Preload("Attachments").
+			Preload("Embeds", orderEmbeds).
+			Where("channel_id = ? AND sequence > ?", s.ChannelID, lastSeq).
+			Order("sequence ASC").
+			Limit(replayPageSize).
+			Find(&messages).Error
+		if err != nil {
+			log.Printf("Failed to load messages for replay: %v", err)
+			break
+		}
+
+		for _, message := range messages {
+			data, _ := json.Marshal(messageEvent(message, message.User))
+			if !s.Client.sendWait(data) {
+				s.Client.close()
+				hub.finishReplay(s, lastSeq)
+				return
 			}
+			lastSeq = message.Sequence
+		}
+
+		replayed += len(messages)
+		if len(messages) < replayPageSize {
+			break
 		}
 	}
+
+	marker := WSMessage{
+		Type:      "replay_complete",
+		ChannelID: s.ChannelID.String(),
+		Sequence:  lastSeq,
+		Timestamp: time.Now(),
+	}
+	if replayed >= maxReplay {
+		// Too far behind to catch up over the socket; refetch over REST
+		marker.Type = "resync_required"
+	}
+	data, _ := json.Marshal(marker)
+	s.Client.sendWait(data)
+
+	hub.finishReplay(s, lastSeq)
+}
+
+// messageEvent is the frame for a newly posted message; replies go out as
+// thread_reply so clients can keep them out of the main timeline
+func messageEvent(message models.Message, author *models.User) WSMessage {
+	msg := WSMessage{
+		Type:      "message",
+		ChannelID: message.ChannelID.String(),
+		Content:   message.Content,
+		Tokens:    markup.Parse(message.Content),
+		MessageID: message.ID.String(),
+		Sequence:  message.Sequence,
+		User: map[string]any{
+			"id":       author.ID,
+			"username": author.Username,
+		},
+		Timestamp: message.CreatedAt,
+	}
+	if len(message.Attachments) > 0 {
+		msg.Attachments = attachmentsResponse(message.Attachments)
+	}
+	if len(message.Embeds) > 0 {
+		msg.Embeds = embedsResponse(message.Embeds)
+	}
+	if message.ParentID != nil {
+		msg.Type = "thread_reply"
+		msg.ParentID = message.ParentID.String()
+	}
+	return msg
 }
 
 func (c *Client) ReadPump() {
@@ -157,8 +808,19 @@ func (c *Client) ReadPump() {
 		}
 
 		var incoming struct {
-			Type    string `json:"type"`
-			Content string `json:"content"`
+			Type      string `json:"type"`
+			ChannelID string `json:"channel_id"`
+			Content   string `json:"content"`
+			ParentID  string `json:"parent_id"`
+			MessageID string `json:"message_id"`
+			Status    string `json:"status"`
+			Since     *int64 `json:"since"`
+
+			AttachmentIDs []string `json:"attachment_ids"`
+		}
+
+		if !c.allow(c.frameLimit, uuid.Nil) {
+			continue
 		}
 
 		if err := json.Unmarshal(messageBytes, &incoming); err != nil {
@@ -166,13 +828,73 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
-		if incoming.Type == "typing" {
-			if !c.IsMember {
+		if c.readOnly && incoming.Type != "subscribe" && incoming.Type != "unsubscribe" {
+			c.sendError(uuid.Nil, "API token is missing the write scope")
+			continue
+		}
+
+		// Presence belongs to the user, not to any one channel
+		if incoming.Type == "presence" {
+			if !isSettablePresence(incoming.Status) {
+				c.sendError(uuid.Nil, "Status must be online, idle or dnd")
+				continue
+			}
+			hub.setStatus(c, incoming.Status)
+			continue
+		}
+
+		channelID := c.DefaultChannelID
+		if incoming.ChannelID != "" {
+			parsed, err := uuid.Parse(incoming.ChannelID)
+			if err != nil {
+				c.sendError(uuid.Nil, "Invalid channel ID")
+				continue
+			}
+			channelID = parsed
+		}
+
+		if channelID == uuid.Nil {
+			c.sendError(uuid.Nil, "channel_id is required")
+			continue
+		}
+
+		switch incoming.Type {
+		case "subscribe":
+			if incoming.Since != nil && *incoming.Since < 0 {
+				c.sendError(channelID, "Invalid since sequence")
+				continue
+			}
+
+			isMember, err := authorizeChannel(c.User, channelID)
+			if err != nil {
+				c.sendError(channelID, err.Error())
+				continue
+			}
+
+			hub.Subscribe <- newSubscription(c, channelID, isMember, incoming.Since)
+
+		case "unsubscribe":
+			hub.Unsubscribe <- &Subscription{Client: c, ChannelID: channelID}
+
+		case "typing":
+			sub := c.memberSubscription(channelID)
+			if sub == nil || !c.allow(c.typingLimit, channelID) {
+				continue
+			}
+
+			// The cached flag is only as fresh as the last membership event, so
+			// confirm before telling the channel anything. This runs after the
+			// rate limit so typing spam can't turn into a query per frame.
+			if !isChannelMember(channelID, c.User.ID) {
+				hub.Mutex.Lock()
+				sub.IsMember = false
+				hub.Mutex.Unlock()
 				continue
 			}
 
 			typingMsg := WSMessage{
-				Type: "typing",
+				Type:      "typing",
+				ChannelID: channelID.String(),
 				User: map[string]any{
 					"id":       c.User.ID,
 					"username": c.User.Username,
@@ -180,64 +902,52 @@ func (c *Client) ReadPump() {
 				Timestamp: time.Now(),
 			}
 			data, _ := json.Marshal(typingMsg)
-			hub.BroadcastToChannel(c.ChannelID, data, c)
-			continue
-		}
+			hub.BroadcastToChannel(channelID, data, c)
 
-		if incoming.Type == "message" && incoming.Content != "" {
-			if !c.IsMember {
-				errorMsg := WSMessage{
-					Type:      "error",
-					Content:   "You must be a member to send messages in this channel",
-					Timestamp: time.Now(),
-				}
-				data, _ := json.Marshal(errorMsg)
-				c.Send <- data
+		case "read":
+			var channel models.Channel
+			if err := database.DB.First(&channel, "id = ?", channelID).Error; err != nil {
+				c.sendError(channelID, errChannelMissing.Error())
 				continue
 			}
 
-			if len(incoming.Content) > 2000 {
-				errorMsg := WSMessage{
-					Type:      "error",
-					Content:   "Message must be less than 2000 characters",
-					Timestamp: time.Now(),
+			seq, advanced, err := markRead(&channel, c.User, incoming.MessageID)
+			if err != nil {
+				if errors.Is(err, errNotChannelMember) || errors.Is(err, errMessageMissing) {
+					c.sendError(channelID, err.Error())
+				} else {
+					log.Printf("Failed to mark channel read: %v", err)
 				}
-				data, _ := json.Marshal(errorMsg)
-				c.Send <- data
 				continue
 			}
 
-			message := models.Message{
-				ID:        uuid.New(),
-				Content:   incoming.Content,
-				UserID:    c.User.ID,
-				ChannelID: c.ChannelID,
+			if advanced {
+				publishToChannel(channelID, readEvent(c.User, seq))
 			}
 
-			if err := database.DB.Create(&message).Error; err != nil {
-				log.Printf("Failed to save message: %v", err)
+		case "message":
+			if !c.allow(c.messageLimit, channelID) {
 				continue
 			}
 
-			now := time.Now()
-			c.User.LastOnline = now
-			database.DB.Model(&c.User).Update("last_online", now)
-
-			wsMsg := WSMessage{
-				Type:      "message",
-				Content:   message.Content,
-				MessageID: message.ID.String(),
-				User: map[string]any{
-					"id":       c.User.ID,
-					"username": c.User.Username,
-				},
-				Timestamp: message.CreatedAt,
+			if c.subscription(channelID) == nil {
+				c.sendError(channelID, errNotSubscribed.Error())
+				continue
 			}
 
-			data, _ := json.Marshal(wsMsg)
-			hub.Broadcast <- &BroadcastMessage{
-				ChannelID: c.ChannelID,
-				Data:      data,
+			_, err := postMessage(c.User, postMessageInput{
+				ChannelID:     channelID,
+				Content:       incoming.Content,
+				ParentID:      incoming.ParentID,
+				AttachmentIDs: incoming.AttachmentIDs,
+			})
+			if err != nil {
+				var rejected *postError
+				if errors.As(err, &rejected) {
+					c.sendError(channelID, rejected.Message)
+				} else {
+					log.Printf("Failed to save message: %v", err)
+				}
 			}
 		}
 	}
@@ -252,18 +962,33 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case message := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
 
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		case <-c.done:
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+
+		case <-ticker.C:
+			// Revoking or expiring a token also ends the sockets opened with it
+			if c.tokenID != uuid.Nil && !middleware.APITokenActive(c.tokenID) {
+				c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				c.Conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "API token revoked or expired"))
+				return
+			}
+			// Likewise a password reset ends sockets opened with an old session
+			if c.tokenID == uuid.Nil && !middleware.SessionCurrent(c.User.ID, c.User.SessionVersion) {
+				c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				c.Conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Session expired"))
 				return
 			}
 
-		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
@@ -272,6 +997,7 @@ func (c *Client) WritePump() {
 	}
 }
 
+// ChatWebSocket serves /ws/:channelId, a connection bound to a single channel
 func ChatWebSocket(c *gin.Context) {
 	channelID := c.Param("channelId")
 
@@ -286,22 +1012,48 @@ func ChatWebSocket(c *gin.Context) {
 		return
 	}
 
-	var channel models.Channel
-	if err := database.DB.Preload("Members").First(&channel, "id = ?", channelID).Error; err != nil {
-		c.JSON(404, gin.H{"error": "Channel not found"})
+	isMember, err := authorizeChannel(user, uuid.MustParse(channelID))
+	if errors.Is(err, errChannelMissing) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(403, gin.H{"error": err.Error()})
 		return
 	}
 
-	isMember := false
-	for _, member := range channel.Members {
-		if member.ID == user.ID {
-			isMember = true
-			break
+	var since *int64
+	if raw := c.Query("since"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(400, gin.H{"error": "Invalid since sequence"})
+			return
 		}
+		since = &parsed
 	}
 
-	if channel.AccessType == "private" && !isMember {
-		c.JSON(403, gin.H{"error": "You must be a member of this private channel"})
+	conn, err := utils.Upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade to WebSocket: %v", err)
+		return
+	}
+
+	client := newClient(conn, user, middleware.GetCurrentAPIToken(c))
+	client.DefaultChannelID = uuid.MustParse(channelID)
+
+	hub.Register <- client
+	hub.Subscribe <- newSubscription(client, client.DefaultChannelID, isMember, since)
+
+	go client.WritePump()
+	go client.ReadPump()
+}
+
+// MultiplexWebSocket serves /ws, a single connection per user that subscribes
+// to channels with subscribe/unsubscribe frames
+func MultiplexWebSocket(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
 		return
 	}
 
@@ -311,13 +1063,7 @@ func ChatWebSocket(c *gin.Context) {
 		return
 	}
 
-	client := &Client{
-		Conn:      conn,
-		User:      user,
-		ChannelID: uuid.MustParse(channelID),
-		Send:      make(chan []byte, 256),
-		IsMember:  isMember,
-	}
+	client := newClient(conn, user, middleware.GetCurrentAPIToken(c))
 
 	hub.Register <- client
 
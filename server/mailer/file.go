@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer is for local development and tests. Each message is logged and,
+// when Dir is set, also written there as a text file so links can be copied.
+type FileMailer struct {
+	Dir string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	return &FileMailer{Dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, msg)
+	count := len(m.sent)
+	m.mu.Unlock()
+
+	log.Printf("mailer: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+
+	if m.Dir == "" {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s-%04d.txt", time.Now().Format("20060102-150405"), count)
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0o640)
+}
+
+// Sent returns every message handed to the mailer so far
+func (m *FileMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
@@ -11,8 +11,12 @@ import (
 
 	"github.com/RudraPatel5435/vyenet/server/database"
 	"github.com/RudraPatel5435/vyenet/server/handlers"
+	"github.com/RudraPatel5435/vyenet/server/mailer"
 	// "github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/pubsub"
 	"github.com/RudraPatel5435/vyenet/server/routes"
+	"github.com/RudraPatel5435/vyenet/server/storage"
+	"github.com/RudraPatel5435/vyenet/server/unfurl"
 	"github.com/joho/godotenv"
 )
 
@@ -24,10 +28,23 @@ func main() {
 
 	database.ConnectDB()
 
-	// database.DB.Migrator().DropTable(&models.User{}, &models.Message{}, &models.Channel{}, &models.MediaSession{}, "user_owned_channels", "channel_members")
-	// database.DB.AutoMigrate(&models.User{}, &models.Message{}, &models.Channel{}, &models.MediaSession{})
+	// database.DB.Migrator().DropTable(&models.User{}, &models.Message{}, &models.Channel{}, &models.MediaSession{}, &models.Invite{}, &models.Reaction{}, &models.Attachment{}, &models.Mention{}, &models.MessageEmbed{}, &models.UserToken{}, &models.RecoveryCode{}, &models.APIToken{}, "user_owned_channels", "channel_members")
+	// database.DB.AutoMigrate(&models.User{}, &models.Message{}, &models.Channel{}, &models.MediaSession{}, &models.Invite{}, &models.ChannelMember{}, &models.Reaction{}, &models.Attachment{}, &models.Mention{}, &models.MessageEmbed{}, &models.UserToken{}, &models.RecoveryCode{}, &models.APIToken{})
 
-	handlers.StartHub()
+	// One-off, together with the AutoMigrate that adds users.email_verified:
+	// accounts from before email verification existed count as verified.
+	// Use the time that migration is deployed as the cutoff, so accounts
+	// registered afterwards still have to confirm their address.
+	// database.BackfillEmailVerified(time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC))
+
+	broker := newBroker()
+	defer broker.Close()
+
+	handlers.StartHub(broker)
+	handlers.SetStorage(newStorage())
+	handlers.StartAttachmentJanitor(15 * time.Minute)
+	handlers.StartUnfurler(unfurl.NewFetcher())
+	handlers.SetMailer(newMailer())
 
 	r := routes.SetupRouter()
 
@@ -56,3 +73,76 @@ func main() {
 	log.Println("Server exited")
 
 }
+
+// newBroker picks the hub backend. HUB_BROKER=postgres lets several replicas
+// share broadcasts; the default keeps everything in process.
+func newBroker() pubsub.Broker {
+	switch os.Getenv("HUB_BROKER") {
+	case "postgres":
+		broker, err := pubsub.NewPostgresBroker(context.Background(), os.Getenv("DATABASE_URL"))
+		if err != nil {
+			log.Fatalf("Failed to start postgres broker: %v", err)
+		}
+		log.Println("Using postgres LISTEN/NOTIFY hub broker")
+		return broker
+	default:
+		return pubsub.NewMemoryBroker()
+	}
+}
+
+// newStorage picks where attachments live. STORAGE_BACKEND=s3 talks to any
+// S3-compatible endpoint (MinIO works for local development); the default
+// writes under UPLOAD_DIR.
+func newStorage() storage.Storage {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "s3":
+		store, err := storage.NewS3Storage(context.Background(), storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+		})
+		if err != nil {
+			log.Fatalf("Failed to connect to S3 storage: %v", err)
+		}
+		log.Println("Using S3 attachment storage")
+		return store
+	default:
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		store, err := storage.NewLocalStorage(dir)
+		if err != nil {
+			log.Fatalf("Failed to prepare upload directory: %v", err)
+		}
+		return store
+	}
+}
+
+// newMailer picks how account emails go out. MAILER=smtp sends through
+// SMTP_HOST; the default logs them and drops a copy in MAIL_DIR if set.
+func newMailer() mailer.Mailer {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			port,
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("MAIL_FROM"),
+		)
+	default:
+		m, err := mailer.NewFileMailer(os.Getenv("MAIL_DIR"))
+		if err != nil {
+			log.Fatalf("Failed to prepare mail directory: %v", err)
+		}
+		return m
+	}
+}
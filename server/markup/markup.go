@@ -0,0 +1,343 @@
+package markup
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token types. Clients render Text as plain text only, so no token can carry
+// markup of its own.
+const (
+	TypeText      = "text"
+	TypeBold      = "bold"
+	TypeItalic    = "italic"
+	TypeCode      = "code"
+	TypeCodeBlock = "code_block"
+	TypeLink      = "link"
+)
+
+// Token is one node of a formatted message. Bold, italic and link tokens hold
+// their contents in Children; text, code and code_block tokens hold Text.
+type Token struct {
+	Type     string  `json:"type"`
+	Text     string  `json:"text,omitempty"`
+	URL      string  `json:"url,omitempty"`
+	Lang     string  `json:"lang,omitempty"`
+	Children []Token `json:"children,omitempty"`
+}
+
+const (
+	fence        = "```"
+	maxDepth     = 4
+	maxLangLen   = 20
+	escapedChars = "\\`*_[]()"
+)
+
+// Parse splits src into tokens for the supported subset: **bold**, *italic*
+// or _italic_, `code`, fenced code blocks, [text](url) links and bare URLs.
+// Anything that doesn't form a complete construct stays literal text.
+func Parse(src string) []Token {
+	var tokens []Token
+
+	rest := src
+	for rest != "" {
+		start := fenceStart(rest)
+		if start < 0 {
+			break
+		}
+
+		lang, body, end, ok := readFence(rest[start:])
+		if !ok {
+			break
+		}
+
+		tokens = appendTokens(tokens, parseInline(rest[:start], 0, true)...)
+		tokens = append(tokens, Token{Type: TypeCodeBlock, Text: body, Lang: lang})
+		rest = rest[start+end:]
+	}
+
+	return appendTokens(tokens, parseInline(rest, 0, true)...)
+}
+
+// fenceStart finds a ``` that begins a line
+func fenceStart(s string) int {
+	offset := 0
+	for {
+		i := strings.Index(s[offset:], fence)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		if i == 0 || s[i-1] == '\n' {
+			return i
+		}
+		offset = i + len(fence)
+	}
+}
+
+// readFence reads a fenced block at the start of s, returning its language,
+// body and the number of bytes consumed. Unclosed fences are not blocks.
+func readFence(s string) (lang, body string, end int, ok bool) {
+	header := s[len(fence):]
+	newline := strings.IndexByte(header, '\n')
+	if newline < 0 {
+		return "", "", 0, false
+	}
+
+	lang = strings.TrimSpace(header[:newline])
+	if !isLang(lang) {
+		return "", "", 0, false
+	}
+
+	contentStart := len(fence) + newline + 1
+	content := s[contentStart:]
+
+	offset := 0
+	for {
+		i := strings.Index(content[offset:], fence)
+		if i < 0 {
+			return "", "", 0, false
+		}
+		i += offset
+		if i == 0 || content[i-1] == '\n' {
+			body = strings.TrimSuffix(content[:i], "\n")
+			end = contentStart + i + len(fence)
+			// Swallow the rest of the closing line's newline
+			if end < len(s) && s[end] == '\n' {
+				end++
+			}
+			return lang, body, end, true
+		}
+		offset = i + len(fence)
+	}
+}
+
+func isLang(lang string) bool {
+	if len(lang) > maxLangLen {
+		return false
+	}
+	for _, r := range lang {
+		if !(r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("+#-_.", r))) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseInline(s string, depth int, allowLinks bool) []Token {
+	var tokens []Token
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = appendTokens(tokens, Token{Type: TypeText, Text: text.String()})
+			text.Reset()
+		}
+	}
+
+	emit := func(token Token) {
+		flush()
+		tokens = appendTokens(tokens, token)
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(escapedChars, s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			// A span opened by a run of backticks closes with a run of the same length
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			marker := s[i : i+run]
+			if j := strings.Index(s[i+run:], marker); j > 0 {
+				emit(Token{Type: TypeCode, Text: s[i+run : i+run+j]})
+				i += run + j + run
+				continue
+			}
+			text.WriteString(marker)
+			i += run
+			continue
+
+		case c == '*' && strings.HasPrefix(s[i:], "**") && depth < maxDepth:
+			// ***text*** is bold and italic at once; read as ** then * it would
+			// close the bold one star early
+			if strings.HasPrefix(s[i:], "***") && depth+1 < maxDepth {
+				if j := strings.Index(s[i+3:], "***"); j > 0 && !isSpaceAt(s, i+3) {
+					italic := Token{Type: TypeItalic, Children: parseInline(s[i+3:i+3+j], depth+2, allowLinks)}
+					emit(Token{Type: TypeBold, Children: []Token{italic}})
+					i += j + 6
+					continue
+				}
+			}
+			if j := strings.Index(s[i+2:], "**"); j > 0 && !isSpaceAt(s, i+2) {
+				emit(Token{Type: TypeBold, Children: parseInline(s[i+2:i+2+j], depth+1, allowLinks)})
+				i += j + 4
+				continue
+			}
+
+		case (c == '*' || c == '_') && depth < maxDepth:
+			if j := closingEmphasis(s, i); j > 0 {
+				emit(Token{Type: TypeItalic, Children: parseInline(s[i+1:j], depth+1, allowLinks)})
+				i = j + 1
+				continue
+			}
+
+		case c == '[' && allowLinks:
+			if label, target, n, ok := readLink(s[i:]); ok {
+				if safe, ok := safeURL(target); ok {
+					emit(Token{Type: TypeLink, URL: safe, Children: parseInline(label, depth+1, false)})
+					i += n
+					continue
+				}
+			}
+
+		case (c == 'h' || c == 'H') && allowLinks && (i == 0 || !isWordByte(s[i-1])):
+			if n := bareURLLen(s[i:]); n > 0 {
+				if safe, ok := safeURL(s[i : i+n]); ok {
+					emit(Token{Type: TypeLink, URL: safe, Children: []Token{{Type: TypeText, Text: s[i : i+n]}}})
+					i += n
+					continue
+				}
+			}
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+
+	flush()
+	return tokens
+}
+
+// closingEmphasis finds the marker closing a single * or _ opened at i.
+// Underscores must sit on word boundaries so snake_case stays literal.
+func closingEmphasis(s string, i int) int {
+	marker := s[i]
+	if i+1 >= len(s) || isSpaceAt(s, i+1) || s[i+1] == marker {
+		return -1
+	}
+	if marker == '_' && i > 0 && isWordByte(s[i-1]) {
+		return -1
+	}
+
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == '\n' {
+			return -1
+		}
+		if s[j] != marker {
+			continue
+		}
+		if marker == '*' && j+1 < len(s) && s[j+1] == '*' {
+			// Part of a ** run; let the bold rule have all of it
+			for j+1 < len(s) && s[j+1] == '*' {
+				j++
+			}
+			continue
+		}
+		if isSpaceAt(s, j-1) {
+			continue
+		}
+		if marker == '_' && j+1 < len(s) && isWordByte(s[j+1]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// readLink parses [label](target) at the start of s
+func readLink(s string) (label, target string, n int, ok bool) {
+	closeLabel := strings.IndexByte(s, ']')
+	if closeLabel <= 1 || strings.ContainsAny(s[1:closeLabel], "[\n") {
+		return "", "", 0, false
+	}
+	if closeLabel+1 >= len(s) || s[closeLabel+1] != '(' {
+		return "", "", 0, false
+	}
+
+	rest := s[closeLabel+2:]
+	closeTarget := strings.IndexByte(rest, ')')
+	if closeTarget <= 0 || strings.ContainsAny(rest[:closeTarget], " \t\n") {
+		return "", "", 0, false
+	}
+
+	return s[1:closeLabel], rest[:closeTarget], closeLabel + 2 + closeTarget + 1, true
+}
+
+// bareURLLen measures an http(s) URL at the start of s, leaving off trailing
+// punctuation that more likely ends the sentence than the URL
+func bareURLLen(s string) int {
+	lower := strings.ToLower(s[:min(len(s), len("https://"))])
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return 0
+	}
+
+	n := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '<' || r == '>' || r == '"' || r == '`'
+	})
+	if n < 0 {
+		n = len(s)
+	}
+
+	for n > 0 && strings.IndexByte(".,:;!?'*_", s[n-1]) >= 0 {
+		n--
+	}
+	if n > 0 && s[n-1] == ')' && strings.Count(s[:n], "(") < strings.Count(s[:n], ")") {
+		n--
+	}
+
+	if n <= len("https://") {
+		return 0
+	}
+	return n
+}
+
+// safeURL only lets through absolute http, https and mailto links, so a
+// javascript: or data: URL can never reach a client as a link
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	return u.String(), true
+}
+
+// appendTokens merges adjacent text tokens as it appends
+func appendTokens(tokens []Token, more ...Token) []Token {
+	for _, token := range more {
+		if n := len(tokens); n > 0 && token.Type == TypeText && tokens[n-1].Type == TypeText {
+			tokens[n-1].Text += token.Text
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func isSpaceAt(s string, i int) bool {
+	return i >= 0 && i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n')
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
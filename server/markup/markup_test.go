@@ -0,0 +1,152 @@
+package markup
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func text(s string) Token { return Token{Type: TypeText, Text: s} }
+func code(s string) Token { return Token{Type: TypeCode, Text: s} }
+func bold(children ...Token) Token {
+	return Token{Type: TypeBold, Children: children}
+}
+func italic(children ...Token) Token {
+	return Token{Type: TypeItalic, Children: children}
+}
+func link(target string, children ...Token) Token {
+	return Token{Type: TypeLink, URL: target, Children: children}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Token
+	}{
+		{"empty", "", nil},
+		{"plain", "hello world", []Token{text("hello world")}},
+
+		{"bold", "**hi**", []Token{bold(text("hi"))}},
+		{"italic star", "*hi*", []Token{italic(text("hi"))}},
+		{"italic underscore", "_hi_", []Token{italic(text("hi"))}},
+		{"bold italic", "***a***", []Token{bold(italic(text("a")))}},
+		{"italic inside bold", "**bold *it* x**", []Token{bold(text("bold "), italic(text("it")), text(" x"))}},
+		{"bold inside italic", "*a **b** c*", []Token{italic(text("a "), bold(text("b")), text(" c"))}},
+		{"snake case stays literal", "snake_case_name", []Token{text("snake_case_name")}},
+		{"spaced stars stay literal", "2 * 3 * 4", []Token{text("2 * 3 * 4")}},
+		{"stars only", "****", []Token{text("****")}},
+
+		{"unterminated bold", "**open", []Token{text("**open")}},
+		{"unterminated italic", "*open", []Token{text("*open")}},
+		{"unterminated code", "`open", []Token{text("`open")}},
+		{"unterminated fence", "```\nopen", []Token{text("```\nopen")}},
+		{"unterminated link", "[a](http://x.y", []Token{text("[a]("), link("http://x.y", text("http://x.y"))}},
+		{"italic across lines", "*a\nb*", []Token{text("*a\nb*")}},
+
+		{"code", "use `x := 1` here", []Token{text("use "), code("x := 1"), text(" here")}},
+		{"code keeps markers", "`**not bold**`", []Token{code("**not bold**")}},
+		{"double backtick code", "``a ` b``", []Token{code("a ` b")}},
+		{"code block", "```go\nx := 1\n```", []Token{{Type: TypeCodeBlock, Text: "x := 1", Lang: "go"}}},
+		{"code block between text", "a\n```\nb\n```\nc", []Token{text("a\n"), {Type: TypeCodeBlock, Text: "b"}, text("c")}},
+		{"escapes", `a\*b\*`, []Token{text("a*b*")}},
+
+		{"link", "[site](https://example.com)", []Token{link("https://example.com", text("site"))}},
+		{"mailto link", "[me](mailto:a@b.c)", []Token{link("mailto:a@b.c", text("me"))}},
+		{"upper case scheme", "[x](HTTP://a.b)", []Token{link("http://a.b", text("x"))}},
+		{"bold link label", "[**a**](http://x.y)", []Token{link("http://x.y", bold(text("a")))}},
+		{"link inside bold", "**[a](http://x.y)**", []Token{bold(link("http://x.y", text("a")))}},
+		{"no links in labels", "[[a](http://x.y)](http://z.w)", []Token{text("["), link("http://x.y", text("a")), text("]("), link("http://z.w", text("http://z.w")), text(")")}},
+		{"bare url", "see https://example.com/x.", []Token{text("see "), link("https://example.com/x", text("https://example.com/x")), text(".")}},
+		{"bare url upper case", "HTTPS://Example.com/x", []Token{link("https://Example.com/x", text("HTTPS://Example.com/x"))}},
+		{"bare url in word", "xhttps://a.b", []Token{text("xhttps://a.b")}},
+
+		{"javascript link", "[x](javascript:alert(1))", []Token{text("[x](javascript:alert(1))")}},
+		{"mixed case javascript link", "[x](JaVaScRiPt:alert(1))", []Token{text("[x](JaVaScRiPt:alert(1))")}},
+		{"data link", "[x](data:text/html,<script>alert(1)</script>)", []Token{text("[x](data:text/html,<script>alert(1)</script>)")}},
+		{"vbscript link", "[x](vbscript:msgbox)", []Token{text("[x](vbscript:msgbox)")}},
+		{"protocol relative link", "[x](//evil.com)", []Token{text("[x](//evil.com)")}},
+		{"relative link", "[x](/settings)", []Token{text("[x](/settings)")}},
+		{"bare javascript", "javascript:alert(1)", []Token{text("javascript:alert(1)")}},
+		{"http without host", "[x](http:/path)", []Token{text("[x](http:/path)")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.src)
+			if !reflect.DeepEqual(got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("Parse(%q)\n got  %s\n want %s", tt.src, gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestParseLimitsNesting(t *testing.T) {
+	src := strings.Repeat("**a *", 50) + "x" + strings.Repeat("* a**", 50)
+	if depth := tokenDepth(Parse(src)); depth > maxDepth+1 {
+		t.Errorf("nesting depth %d exceeds limit %d", depth, maxDepth+1)
+	}
+}
+
+func tokenDepth(tokens []Token) int {
+	deepest := 0
+	for _, token := range tokens {
+		deepest = max(deepest, 1+tokenDepth(token.Children))
+	}
+	return deepest
+}
+
+// checkTokens enforces what clients rely on: only http(s) and mailto links,
+// leaf tokens without children, and bounded nesting
+func checkTokens(t *testing.T, src string, tokens []Token, depth int) {
+	t.Helper()
+	if depth > maxDepth+1 {
+		t.Fatalf("Parse(%q): nesting deeper than %d", src, maxDepth+1)
+	}
+
+	for _, token := range tokens {
+		switch token.Type {
+		case TypeText, TypeCode, TypeCodeBlock:
+			if len(token.Children) > 0 {
+				t.Fatalf("Parse(%q): %s token has children", src, token.Type)
+			}
+		case TypeBold, TypeItalic:
+		case TypeLink:
+			u, err := url.Parse(token.URL)
+			if err != nil {
+				t.Fatalf("Parse(%q): link %q doesn't parse: %v", src, token.URL, err)
+			}
+			switch strings.ToLower(u.Scheme) {
+			case "http", "https", "mailto":
+			default:
+				t.Fatalf("Parse(%q): unsafe link %q", src, token.URL)
+			}
+			if strings.ContainsAny(token.URL, " \t\n") {
+				t.Fatalf("Parse(%q): link %q contains unescaped whitespace", src, token.URL)
+			}
+		default:
+			t.Fatalf("Parse(%q): unknown token type %q", src, token.Type)
+		}
+		checkTokens(t, src, token.Children, depth+1)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		"", "**bold** *it* _it_ `code`", "***a***", "*a **b** c*",
+		"```go\nx\n```", "[a](https://x.y)", "[a](javascript:alert(1))",
+		"[a](JaVaScRiPt:x)", "[a](data:text/html,x)", "https://a.b/c).",
+		`\*\[\]`, "[**[a](http://b.c)**](http://d.e)", "``a`b``",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		checkTokens(t, src, Parse(src), 0)
+	})
+}
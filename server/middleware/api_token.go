@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/RudraPatel5435/vyenet/server/database"
+	"github.com/RudraPatel5435/vyenet/server/models"
+	"github.com/RudraPatel5435/vyenet/server/utils"
+)
+
+// last_used_at is only a hint for the token list, so it isn't rewritten on
+// every request
+const tokenUsageResolution = time.Minute
+
+var (
+	errTokenInvalid = errors.New("Invalid or revoked API token")
+	errTokenExpired = errors.New("API token has expired")
+)
+
+// bearerToken pulls the token out of an Authorization: Bearer header. ok is
+// false when the request doesn't use bearer auth at all.
+func bearerToken(c *gin.Context) (token string, ok bool) {
+	scheme, value, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+func authenticateAPIToken(plaintext string) (*models.User, *models.APIToken, error) {
+	if plaintext == "" {
+		return nil, nil, errTokenInvalid
+	}
+
+	var token models.APIToken
+	if err := database.DB.First(&token, "token_hash = ?", utils.HashToken(plaintext)).Error; err != nil {
+		return nil, nil, errTokenInvalid
+	}
+	if token.RevokedAt != nil {
+		return nil, nil, errTokenInvalid
+	}
+	if !token.IsActive() {
+		return nil, nil, errTokenExpired
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", token.UserID).Error; err != nil {
+		return nil, nil, errTokenInvalid
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > tokenUsageResolution {
+		now := time.Now()
+		database.DB.Model(&token).Update("last_used_at", now)
+		token.LastUsedAt = &now
+	}
+
+	return &user, &token, nil
+}
+
+// requiredScope maps a request onto the scope a token needs for it
+func requiredScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.ScopeRead
+	default:
+		return models.ScopeWrite
+	}
+}
+
+// APITokenActive reports whether a token is still usable, for long-lived
+// connections that authenticated with it
+func APITokenActive(tokenID uuid.UUID) bool {
+	var token models.APIToken
+	if err := database.DB.First(&token, "id = ?", tokenID).Error; err != nil {
+		return false
+	}
+	return token.IsActive()
+}
+
+// GetCurrentAPIToken returns the token the request authenticated with, or nil
+// for a session login
+func GetCurrentAPIToken(c *gin.Context) *models.APIToken {
+	token, exists := c.Get("apiToken")
+	if !exists {
+		return nil
+	}
+	return token.(*models.APIToken)
+}
+
+// RequireSession keeps API tokens away from account security routes, so a
+// leaked token can't mint more tokens or turn off two-factor
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetCurrentAPIToken(c) != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This action requires logging in with a password",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TokenBucket allows bursts of up to burst events, refilled at one token per
+// interval. It is safe for concurrent use.
+type TokenBucket struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+func NewTokenBucket(interval time.Duration, burst int) *TokenBucket {
+	return &TokenBucket{
+		interval: interval,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Take spends a token if one is available. Otherwise it reports how long
+// until the next one is.
+func (b *TokenBucket) Take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+float64(now.Sub(b.last))/float64(b.interval))
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) * float64(b.interval))
+	return false, wait
+}
+
+func (b *TokenBucket) idleSince() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
+
+// RateLimiter keeps one TokenBucket per key. Buckets live in memory, so with
+// several replicas each one enforces the limit separately.
+type RateLimiter struct {
+	interval time.Duration
+	burst    int
+
+	mu        sync.Mutex
+	buckets   map[string]*TokenBucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(interval time.Duration, burst int) *RateLimiter {
+	return &RateLimiter{
+		interval:  interval,
+		burst:     burst,
+		buckets:   make(map[string]*TokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewTokenBucket(l.interval, l.burst)
+		l.buckets[key] = bucket
+	}
+	l.sweep()
+	l.mu.Unlock()
+
+	return bucket.Take()
+}
+
+// sweep drops buckets that have refilled completely, which are no different
+// from new ones. Must be called with l.mu held.
+func (l *RateLimiter) sweep() {
+	full := l.interval * time.Duration(l.burst)
+	if time.Since(l.lastSweep) < max(full, time.Minute) {
+		return
+	}
+	l.lastSweep = time.Now()
+
+	for key, bucket := range l.buckets {
+		if time.Since(bucket.idleSince()) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit throttles requests per signed-in user, or per client IP before
+// authentication has run
+func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if userID := GetCurrentUserID(c); userID != uuid.Nil {
+			key = "user:" + userID.String()
+		}
+
+		if ok, wait := limiter.Allow(key); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests, please slow down",
+				"retry_after": retryAfter,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
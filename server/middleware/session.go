@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/postgres"
@@ -36,8 +37,46 @@ func InitSessionStore(db *gorm.DB) (sessions.Store, error) {
 	return store, nil
 }
 
+// sessionVersionKey holds the user's SessionVersion at login; bumping the
+// column signs out every session saved with an older one
+const sessionVersionKey = "session_version"
+
+// A session that has passed the password check but not yet the second factor
+// carries these keys. It isn't logged in until CompleteTwoFactor runs.
+const (
+	pendingTwoFactorKey      = "pending_2fa"
+	pendingTwoFactorFailures = "pending_2fa_failures"
+	pendingTwoFactorTTL      = 5 * time.Minute
+	maxTwoFactorFailures     = 5
+)
+
+// SessionAuth accepts either the session cookie or an API token sent as
+// Authorization: Bearer
 func SessionAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if plaintext, ok := bearerToken(c); ok {
+			user, token, err := authenticateAPIToken(plaintext)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": err.Error(),
+				})
+				c.Abort()
+				return
+			}
+
+			if scope := requiredScope(c.Request.Method); !token.HasScope(scope) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "API token is missing the " + scope + " scope",
+				})
+				c.Abort()
+				return
+			}
+
+			c.Set("apiToken", token)
+			authorizeUser(c, user)
+			return
+		}
+
 		session := sessions.Default(c)
 		userID := session.Get("user_id")
 
@@ -49,6 +88,14 @@ func SessionAuth() gin.HandlerFunc {
 			return
 		}
 
+		if session.Get(pendingTwoFactorKey) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Two-factor authentication required",
+			})
+			c.Abort()
+			return
+		}
+
 		uuid, err := uuid.Parse(userID.(string))
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -67,19 +114,116 @@ func SessionAuth() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user", &user)
-		c.Set("userID", user.ID)
+		// Sessions from before the last password reset are no longer valid
+		if version, _ := session.Get(sessionVersionKey).(int); version != user.SessionVersion {
+			session.Clear()
+			session.Save()
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Your session has expired, please log in again",
+			})
+			c.Abort()
+			return
+		}
+
+		authorizeUser(c, &user)
+	}
+}
+
+// authorizeUser applies the checks common to every way of logging in and
+// stores the user for the handlers
+func authorizeUser(c *gin.Context, user *models.User) {
+	if !user.EmailVerified && UnverifiedPolicy() == PolicyBlock && !unverifiedExemptRoutes[c.FullPath()] {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Please verify your email address",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("user", user)
+	c.Set("userID", user.ID)
+
+	c.Next()
+}
+
+// SetUserSession starts a fresh login for user, dropping anything left in the
+// session, such as an abandoned two-factor step
+func SetUserSession(c *gin.Context, user *models.User) error {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("user_id", user.ID.String())
+	session.Set(sessionVersionKey, user.SessionVersion)
+	return session.Save()
+}
 
-		c.Next()
+// SessionCurrent reports whether sessions at version are still valid for the
+// user, for long-lived connections that authenticated with one
+func SessionCurrent(userID uuid.UUID, version int) bool {
+	var user models.User
+	if err := database.DB.Select("session_version").First(&user, "id = ?", userID).Error; err != nil {
+		return false
 	}
+	return user.SessionVersion == version
 }
 
-func SetUserSession(c *gin.Context, userID uuid.UUID) error {
+// SetPendingTwoFactor starts a half-authenticated session for user, which
+// SessionAuth turns away until the second factor is checked
+func SetPendingTwoFactor(c *gin.Context, user *models.User) error {
 	session := sessions.Default(c)
-	session.Set("user_id", userID.String())
+	session.Clear()
+	session.Set("user_id", user.ID.String())
+	session.Set(sessionVersionKey, user.SessionVersion)
+	session.Set(pendingTwoFactorKey, time.Now().Unix())
 	return session.Save()
 }
 
+// PendingTwoFactorUser returns the user waiting on a second factor, if the
+// session is half-authenticated and the password check was recent enough
+func PendingTwoFactorUser(c *gin.Context) (uuid.UUID, bool) {
+	session := sessions.Default(c)
+
+	started, ok := session.Get(pendingTwoFactorKey).(int64)
+	if !ok || time.Since(time.Unix(started, 0)) > pendingTwoFactorTTL {
+		return uuid.Nil, false
+	}
+
+	userID, ok := session.Get("user_id").(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// CompleteTwoFactor promotes a half-authenticated session to a full login
+func CompleteTwoFactor(c *gin.Context) error {
+	session := sessions.Default(c)
+	session.Delete(pendingTwoFactorKey)
+	session.Delete(pendingTwoFactorFailures)
+	return session.Save()
+}
+
+// FailTwoFactor counts a wrong code. Once too many pile up the session is
+// dropped and the user has to enter their password again; it reports whether
+// that happened.
+func FailTwoFactor(c *gin.Context) (bool, error) {
+	session := sessions.Default(c)
+
+	failures, _ := session.Get(pendingTwoFactorFailures).(int)
+	failures++
+	if failures >= maxTwoFactorFailures {
+		session.Clear()
+		return true, session.Save()
+	}
+
+	session.Set(pendingTwoFactorFailures, failures)
+	return false, session.Save()
+}
+
 func ClearUserSession(c *gin.Context) error {
 	session := sessions.Default(c)
 	session.Clear()
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"os"
+
+	"github.com/RudraPatel5435/vyenet/server/models"
+)
+
+// What a user who hasn't confirmed their email may do, set with
+// UNVERIFIED_USER_POLICY
+const (
+	PolicyAllow     = "allow"      // everything
+	PolicyNoPosting = "no_posting" // read, but not post, edit, react or upload (default)
+	PolicyBlock     = "block"      // nothing beyond verifying and logging out
+)
+
+// Routes a blocked user can still reach so they're able to get unblocked
+var unverifiedExemptRoutes = map[string]bool{
+	"/api/user/me":                  true,
+	"/api/user/logout":              true,
+	"/api/user/resend-verification": true,
+}
+
+func UnverifiedPolicy() string {
+	switch policy := os.Getenv("UNVERIFIED_USER_POLICY"); policy {
+	case PolicyAllow, PolicyBlock:
+		return policy
+	default:
+		return PolicyNoPosting
+	}
+}
+
+// CanPost reports whether the user may send, edit and react to messages and
+// upload files
+func CanPost(user *models.User) bool {
+	return user.EmailVerified || UnverifiedPolicy() == PolicyAllow
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API token scopes. Read covers GET requests and receiving on WebSockets;
+// write covers everything that changes state, including sending over them.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// APIToken is a personal access token a user creates for scripts and bots.
+// Like UserToken only the SHA-256 is kept; Prefix is enough of the plaintext
+// for the user to tell their tokens apart.
+type APIToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID  `gorm:"type:uuid;index;not null"`
+	User       *User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name       string     `gorm:"type:varchar(100);not null"`
+	Prefix     string     `gorm:"type:varchar(16);not null"`
+	TokenHash  string     `gorm:"type:char(64);uniqueIndex;not null"`
+	Scopes     string     `gorm:"type:varchar(100);not null"`
+	ExpiresAt  time.Time  `gorm:"not null"`
+	LastUsedAt *time.Time `gorm:"default:null"`
+	RevokedAt  *time.Time `gorm:"default:null"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+}
+
+func (t *APIToken) ScopeList() []string {
+	return strings.Split(t.Scopes, ",")
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.ScopeList(), scope)
+}
+
+func (t *APIToken) IsActive() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
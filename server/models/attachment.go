@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Attachment is an uploaded file. It is uploaded to a channel first and linked
+// to a message when that message is sent.
+type Attachment struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey"`
+	ChannelID   uuid.UUID      `gorm:"type:uuid;index;not null"`
+	Channel     *Channel       `gorm:"foreignKey:ChannelID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UploaderID  uuid.UUID      `gorm:"type:uuid;index;not null"`
+	Uploader    *User          `gorm:"foreignKey:UploaderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	MessageID   *uuid.UUID     `gorm:"type:uuid;index"` // nil until the upload is sent with a message
+	Message     *Message       `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Filename    string         `gorm:"type:varchar(255);not null"`
+	ContentType string         `gorm:"type:varchar(100);not null"`
+	Size        int64          `gorm:"not null"`
+	StorageKey  string         `gorm:"type:varchar(255);uniqueIndex;not null"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime"`
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
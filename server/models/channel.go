@@ -11,7 +11,9 @@ type Channel struct {
 	Name       string         `gorm:"type:varchar(100);not null"`
 	AdminID    uuid.UUID      `gorm:"not null"`
 	Admin      *User          `gorm:"foreignKey:AdminID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	AccessType string         `gorm:"type:varchar(10);not null; check:access_type IN ('public','private');default:'public'"`
+	AccessType string         `gorm:"type:varchar(10);not null; check:access_type IN ('public','private','direct');default:'public'"`
+	DirectKey  *string        `gorm:"type:varchar(80);uniqueIndex"` // sorted participant IDs, set only for direct channels
+	LastSeq    int64          `gorm:"not null;default:0"`
 	Members    []*User        `gorm:"many2many:channel_members;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	Messages   []*Message     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	CreatedAt  time.Time      `gorm:"autoCreateTime"`
@@ -19,6 +21,15 @@ type Channel struct {
 	DeletedAt  gorm.DeletedAt `gorm:"index"`
 }
 
+// IsMembersOnly reports whether only members may read the channel
+func (c *Channel) IsMembersOnly() bool {
+	return c.AccessType == "private" || c.AccessType == "direct"
+}
+
+func (c *Channel) IsDirect() bool {
+	return c.AccessType == "direct"
+}
+
 // func (c *Channel) BeforeCreate(tx *gorm.DB) (err error) {
 // 	c.ID = uuid.New()
 // 	return
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+	RoleReadOnly  = "read_only"
+)
+
+type Permission string
+
+const (
+	PermSendMessages   Permission = "send_messages"
+	PermDeleteMessages Permission = "delete_messages"
+	PermPinMessages    Permission = "pin_messages"
+	PermManageInvites  Permission = "manage_invites"
+	PermManageMembers  Permission = "manage_members"
+	PermRenameChannel  Permission = "rename_channel"
+	PermChangeAccess   Permission = "change_access"
+	PermDeleteChannel  Permission = "delete_channel"
+	PermManageRoles    Permission = "manage_roles"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleOwner: {
+		PermSendMessages, PermDeleteMessages, PermPinMessages, PermManageInvites,
+		PermManageMembers, PermRenameChannel, PermChangeAccess, PermDeleteChannel,
+		PermManageRoles,
+	},
+	RoleModerator: {
+		PermSendMessages, PermDeleteMessages, PermPinMessages, PermManageInvites,
+		PermManageMembers, PermRenameChannel,
+	},
+	RoleMember:   {PermSendMessages},
+	RoleReadOnly: {},
+}
+
+var roleRank = map[string]int{
+	RoleOwner:     3,
+	RoleModerator: 2,
+	RoleMember:    1,
+	RoleReadOnly:  0,
+}
+
+// ChannelMember is the channel_members join table behind Channel.Members
+type ChannelMember struct {
+	ChannelID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Role      string    `gorm:"type:varchar(20);not null;check:role IN ('owner','moderator','member','read_only');default:'member'"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	// Read pointer: everything up to this channel sequence has been seen
+	LastReadSeq int64      `gorm:"not null;default:0"`
+	LastReadAt  *time.Time `gorm:"default:null"`
+}
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func RoleHasPermission(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// RoleOutranks reports whether a member with role a may act on a member with role b
+func RoleOutranks(a, b string) bool {
+	return roleRank[a] > roleRank[b]
+}
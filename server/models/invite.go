@@ -0,0 +1,30 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type Invite struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey"`
+	Code        string         `gorm:"type:varchar(32);uniqueIndex;not null"`
+	ChannelID   uuid.UUID      `gorm:"type:uuid;index;not null"`
+	Channel     *Channel       `gorm:"foreignKey:ChannelID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedByID uuid.UUID      `gorm:"type:uuid;not null"`
+	CreatedBy   *User          `gorm:"foreignKey:CreatedByID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	MaxUses     int            `gorm:"not null;default:0"` // 0 means unlimited
+	Uses        int            `gorm:"not null;default:0"`
+	ExpiresAt   *time.Time     `gorm:"index"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (i *Invite) IsExpired() bool {
+	return i.ExpiresAt != nil && time.Now().After(*i.ExpiresAt)
+}
+
+func (i *Invite) IsExhausted() bool {
+	return i.MaxUses > 0 && i.Uses >= i.MaxUses
+}
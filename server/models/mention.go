@@ -0,0 +1,23 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	MentionUser    = "user"
+	MentionChannel = "channel"
+)
+
+// Mention records that a message notified a user, either by @username or
+// through @channel. A user is mentioned at most once per message.
+type Mention struct {
+	MessageID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Message   *Message  `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_mentions_user_created,priority:1"`
+	User      *User     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ChannelID uuid.UUID `gorm:"type:uuid;index;not null"`
+	Kind      string    `gorm:"type:varchar(10);not null;check:kind IN ('user','channel');default:'user'"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index:idx_mentions_user_created,priority:2"`
+}
@@ -7,16 +7,30 @@ import (
 )
 
 type Message struct {
-	ID        uuid.UUID      `gorm:"type:uuid;primaryKey"`
-	UserID    uuid.UUID      `gorm:"index"`
-	User      *User          `gorm:"foreignKey:UserID"`
-	ChannelID uuid.UUID      `gorm:"index"`
-	Channel   *Channel       `gorm:"foreignKey:ChannelID"`
-	IsPinned  bool           `gorm:"default:false"`
-	Content   string         `gorm:"not null"`
-	CreatedAt time.Time      `gorm:"autoCreateTime"`
-	UpdatedAt time.Time      `gorm:"autoUpdateTime"`
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID      `gorm:"index"`
+	User        *User          `gorm:"foreignKey:UserID"`
+	ChannelID   uuid.UUID      `gorm:"index;index:idx_channel_sequence,priority:1"`
+	Sequence    int64          `gorm:"not null;default:0;index:idx_channel_sequence,priority:2"`
+	Channel     *Channel       `gorm:"foreignKey:ChannelID"`
+	ParentID    *uuid.UUID     `gorm:"type:uuid;index"` // replies point at a top-level message; threads don't nest
+	Parent      *Message       `gorm:"foreignKey:ParentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ReplyCount  int            `gorm:"not null;default:0"`
+	LastReplyAt *time.Time     `gorm:"default:null"`
+	IsPinned    bool           `gorm:"default:false"`
+	PinnedAt    *time.Time     `gorm:"index"`
+	PinnedBy    *uuid.UUID     `gorm:"type:uuid"`
+	Content     string         `gorm:"not null"`
+	Attachments []Attachment   `gorm:"foreignKey:MessageID"`
+	Mentions    []Mention      `gorm:"foreignKey:MessageID"`
+	Embeds      []MessageEmbed `gorm:"foreignKey:MessageID"`
+	EditedAt    *time.Time     `gorm:"default:null"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+
+	// Maintained by Postgres for full-text search; never read or written by gorm
+	SearchVector string `gorm:"type:tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;index:idx_messages_search,type:gin;->:false;<-:false" json:"-"`
 }
 
 // func (m *Message) BeforeCreate(tx *gorm.DB) (err error) {
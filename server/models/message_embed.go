@@ -0,0 +1,20 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// MessageEmbed is a link preview unfurled from a URL in a message
+type MessageEmbed struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	MessageID   uuid.UUID `gorm:"type:uuid;index;not null"`
+	Message     *Message  `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Position    int       `gorm:"not null;default:0"`
+	URL         string    `gorm:"type:text;not null"`
+	Title       string    `gorm:"type:varchar(300)"`
+	Description string    `gorm:"type:varchar(500)"`
+	ImageURL    string    `gorm:"type:text"`
+	SiteName    string    `gorm:"type:varchar(300)"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Reaction is one user's emoji on a message; a user can add several different
+// emoji to the same message but each only once
+type Reaction struct {
+	MessageID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Message   *Message  `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	User      *User     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Emoji     string    `gorm:"type:varchar(64);primaryKey"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
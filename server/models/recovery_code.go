@@ -0,0 +1,17 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RecoveryCode lets a user past two-factor login without their authenticator.
+// Each works once and only its SHA-256 is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index;not null"`
+	User      *User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CodeHash  string     `gorm:"type:char(64);not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
@@ -7,15 +7,21 @@ import (
 )
 
 type User struct {
-	ID            uuid.UUID      `gorm:"type:uuid;primaryKey"`
-	Username      string         `gorm:"uniqueIndex;not null"`
-	Email         string         `gorm:"uniqueIndex;not null"`
-	Password      string         `gorm:"not null"`
-	OwnedChannels []*Channel     `gorm:"many2many:user_owned_channels;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	LastOnline    time.Time      `gorm:"default:CURRENT_TIMESTAMP"`
-	CreatedAt     time.Time      `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time      `gorm:"autoUpdateTime"`
-	DeletedAt     gorm.DeletedAt `gorm:"index"`
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Username      string    `gorm:"uniqueIndex;not null"`
+	Email         string    `gorm:"uniqueIndex;not null"`
+	Password      string    `gorm:"not null"`
+	EmailVerified bool      `gorm:"not null;default:false"`
+	TOTPSecret    string    `gorm:"type:varchar(64)"`
+	TOTPEnabled   bool      `gorm:"not null;default:false"`
+	TOTPLastStep  int64     `gorm:"not null;default:0"`
+	// Bumped to sign out every existing session, e.g. after a password reset
+	SessionVersion int            `gorm:"not null;default:0"`
+	OwnedChannels  []*Channel     `gorm:"many2many:user_owned_channels;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	LastOnline     time.Time      `gorm:"default:CURRENT_TIMESTAMP"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
 }
 
 // func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
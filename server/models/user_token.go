@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	TokenPasswordReset = "password_reset"
+	TokenEmailVerify   = "email_verify"
+)
+
+// UserToken is a single-use secret emailed to a user. Only the SHA-256 of the
+// token is stored, so a database leak doesn't hand out working links.
+type UserToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index;not null"`
+	User      *User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Purpose   string     `gorm:"type:varchar(20);not null"`
+	TokenHash string     `gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+func (t *UserToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
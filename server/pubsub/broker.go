@@ -0,0 +1,16 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrBrokerClosed = errors.New("broker is closed")
+
+// Broker fans payloads out to every subscriber, including ones on other
+// server instances. Subscribers also receive their own publications.
+type Broker interface {
+	Publish(ctx context.Context, payload []byte) error
+	Subscribe(ctx context.Context) (<-chan []byte, error)
+	Close() error
+}
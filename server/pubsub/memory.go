@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker delivers payloads within a single process. It is the default
+// for single-instance deployments and tests.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[chan []byte]struct{}
+	closed      bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[chan []byte]struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, payload []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- payload:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context) (<-chan []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	sub := make(chan []byte, 256)
+	b.subscribers[sub] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		if _, ok := b.subscribers[sub]; ok {
+			delete(b.subscribers, sub)
+			close(sub)
+		}
+		b.mu.Unlock()
+	}()
+
+	return sub, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub)
+	}
+	return nil
+}
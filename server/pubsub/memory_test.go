@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, ch <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case payload, ok := <-ch:
+		if !ok {
+			t.Fatal("subscription closed unexpectedly")
+		}
+		return payload
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for payload")
+		return nil
+	}
+}
+
+func TestMemoryBrokerFansOutToEverySubscriber(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, err := broker.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	second, err := broker.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	for _, payload := range []string{"one", "two"} {
+		if err := broker.Publish(ctx, []byte(payload)); err != nil {
+			t.Fatalf("Publish(%q): %v", payload, err)
+		}
+	}
+
+	for _, sub := range []<-chan []byte{first, second} {
+		for _, want := range []string{"one", "two"} {
+			if got := string(receive(t, sub)); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		}
+	}
+}
+
+func TestMemoryBrokerUnsubscribesOnCancel(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := broker.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-sub:
+		if ok {
+			t.Fatal("expected the subscription to be closed, got a payload")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not closed after cancel")
+	}
+
+	// Publishing with nobody listening must not block
+	if err := broker.Publish(context.Background(), []byte("late")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func TestMemoryBrokerClose(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	sub, err := broker.Subscribe(context.Background())
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	if err := broker.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, ok := <-sub; ok {
+		t.Error("subscription still open after Close")
+	}
+
+	if err := broker.Publish(context.Background(), []byte("x")); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Publish after Close = %v, want ErrBrokerClosed", err)
+	}
+	if _, err := broker.Subscribe(context.Background()); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Subscribe after Close = %v, want ErrBrokerClosed", err)
+	}
+	if err := broker.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+}
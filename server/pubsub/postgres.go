@@ -0,0 +1,218 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	notifyChannel = "vyenet_hub"
+
+	// NOTIFY payloads are capped just under 8000 bytes; anything larger is
+	// parked in hub_payloads and the notification carries its row ID instead
+	maxNotifyPayload = 7900
+
+	inlinePrefix = "i:"
+	refPrefix    = "r:"
+)
+
+// PostgresBroker relays payloads between server instances with LISTEN/NOTIFY
+type PostgresBroker struct {
+	pool   *pgxpool.Pool
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.RWMutex
+	subscribers map[chan []byte]struct{}
+	closed      bool
+}
+
+func NewPostgresBroker(ctx context.Context, dsn string) (*PostgresBroker, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS hub_payloads (
+		id BIGSERIAL PRIMARY KEY,
+		payload TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	brokerCtx, cancel := context.WithCancel(context.Background())
+	b := &PostgresBroker{
+		pool:        pool,
+		ctx:         brokerCtx,
+		cancel:      cancel,
+		subscribers: make(map[chan []byte]struct{}),
+	}
+
+	go b.listen()
+
+	return b, nil
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, payload []byte) error {
+	if b.ctx.Err() != nil {
+		return ErrBrokerClosed
+	}
+
+	if len(inlinePrefix)+len(payload) <= maxNotifyPayload {
+		_, err := b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", notifyChannel, inlinePrefix+string(payload))
+		return err
+	}
+
+	var id int64
+	if err := b.pool.QueryRow(ctx,
+		"INSERT INTO hub_payloads (payload) VALUES ($1) RETURNING id", string(payload),
+	).Scan(&id); err != nil {
+		return err
+	}
+
+	if _, err := b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", notifyChannel, refPrefix+strconv.FormatInt(id, 10)); err != nil {
+		return err
+	}
+
+	// Every instance has had ample time to read older parked payloads
+	_, err := b.pool.Exec(ctx, "DELETE FROM hub_payloads WHERE created_at < now() - interval '5 minutes'")
+	return err
+}
+
+func (b *PostgresBroker) Subscribe(ctx context.Context) (<-chan []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	sub := make(chan []byte, 256)
+	b.subscribers[sub] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-b.ctx.Done():
+		}
+		b.mu.Lock()
+		if _, ok := b.subscribers[sub]; ok {
+			delete(b.subscribers, sub)
+			close(sub)
+		}
+		b.mu.Unlock()
+	}()
+
+	return sub, nil
+}
+
+func (b *PostgresBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	b.cancel()
+	b.pool.Close()
+	return nil
+}
+
+func (b *PostgresBroker) listen() {
+	backoff := time.Second
+	for {
+		listening, err := b.listenOnce()
+		if b.ctx.Err() != nil {
+			return
+		}
+		if listening {
+			backoff = time.Second
+		}
+
+		log.Printf("pubsub: postgres listener stopped: %v, reconnecting in %s", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-b.ctx.Done():
+			return
+		}
+
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (b *PostgresBroker) listenOnce() (bool, error) {
+	pooled, err := b.pool.Acquire(b.ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// LISTEN state is per connection, so take it out of the pool for good
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(b.ctx, "LISTEN "+notifyChannel); err != nil {
+		return false, err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(b.ctx)
+		if err != nil {
+			return true, err
+		}
+
+		payload, err := b.resolve(notification.Payload)
+		if err != nil {
+			log.Printf("pubsub: dropping notification: %v", err)
+			continue
+		}
+
+		b.dispatch(payload)
+	}
+}
+
+func (b *PostgresBroker) resolve(raw string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(raw, inlinePrefix):
+		return []byte(strings.TrimPrefix(raw, inlinePrefix)), nil
+	case strings.HasPrefix(raw, refPrefix):
+		id, err := strconv.ParseInt(strings.TrimPrefix(raw, refPrefix), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		var payload string
+		if err := b.pool.QueryRow(b.ctx, "SELECT payload FROM hub_payloads WHERE id = $1", id).Scan(&payload); err != nil {
+			return nil, err
+		}
+		return []byte(payload), nil
+	default:
+		return nil, fmt.Errorf("unknown payload format %q", raw)
+	}
+}
+
+func (b *PostgresBroker) dispatch(payload []byte) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- payload:
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
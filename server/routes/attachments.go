@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/RudraPatel5435/vyenet/server/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAttachmentRoutes(rg *gin.RouterGroup) {
+	attachments := rg.Group("/channels/:id/attachments")
+	{
+		attachments.POST("", handlers.UploadAttachment)
+		attachments.GET("/:attachmentId", handlers.DownloadAttachment)
+	}
+}
@@ -14,6 +14,7 @@ func RegisterChannelRoutes(rg *gin.RouterGroup) {
 		channels.DELETE("/:id", handlers.DeleteChannel)
 		channels.POST("/:id/join", handlers.JoinChannel)
 		channels.POST("/:id/leave", handlers.LeaveChannel)
+		channels.POST("/:id/transfer-ownership", handlers.TransferOwnership)
 		channels.PUT("/:id/access/:type", handlers.ChangeAccessType)
 		channels.PATCH("/:id/change-name/:name", handlers.ChangeChannelName)
 	}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/RudraPatel5435/vyenet/server/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterDirectMessageRoutes(rg *gin.RouterGroup) {
+	dms := rg.Group("/dms")
+	{
+		dms.POST("", handlers.OpenDirectMessage)
+		dms.GET("", handlers.ListDirectMessages)
+	}
+}
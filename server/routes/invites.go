@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/RudraPatel5435/vyenet/server/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterInviteRoutes(rg *gin.RouterGroup) {
+	invites := rg.Group("/channels/:id/invites")
+	{
+		invites.POST("", handlers.CreateInvite)
+		invites.GET("", handlers.ListInvites)
+		invites.DELETE("/:inviteId", handlers.RevokeInvite)
+	}
+
+	rg.POST("/invites/:code/redeem", handlers.RedeemInvite)
+}
@@ -1,13 +1,16 @@
 package routes
 
 import (
-	// "github.com/RudraPatel5435/vyenet/server/handlers"
+	"github.com/RudraPatel5435/vyenet/server/handlers"
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterMemberRoutes(rg *gin.RouterGroup) {
 	members := rg.Group("/channels/:id/member")
 	{
-		members.GET("")
+		members.GET("", handlers.ListMembers)
+		members.POST("", handlers.AddMember)
+		members.DELETE("/:userId", handlers.KickMember)
+		members.PUT("/:userId/role", handlers.ChangeMemberRole)
 	}
 }
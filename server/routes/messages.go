@@ -10,5 +10,16 @@ func RegisterMessageRoutes(rg *gin.RouterGroup) {
 	{
 		messages.POST("", handlers.CreateMessage)
 		messages.GET("", handlers.ListMessages)
+		messages.PATCH("/:messageId", handlers.EditMessage)
+		messages.DELETE("/:messageId", handlers.DeleteMessage)
+		messages.POST("/:messageId/pin", handlers.PinMessage)
+		messages.DELETE("/:messageId/pin", handlers.UnpinMessage)
+		messages.GET("/:messageId/thread", handlers.ListThread)
+		messages.POST("/:messageId/reactions", handlers.AddReaction)
+		messages.DELETE("/:messageId/reactions/:emoji", handlers.RemoveReaction)
 	}
+
+	rg.GET("/channels/:id/pins", handlers.ListPinnedMessages)
+	rg.POST("/channels/:id/read", handlers.MarkChannelRead)
+	rg.GET("/messages/search", handlers.SearchMessages)
 }
@@ -2,6 +2,9 @@ package routes
 
 import (
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/RudraPatel5435/vyenet/server/database"
 	"github.com/RudraPatel5435/vyenet/server/handlers"
@@ -14,6 +17,13 @@ import (
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
 
+	// Rate limits key on ClientIP, so X-Forwarded-For is only honoured when
+	// it comes from a proxy listed in TRUSTED_PROXIES (comma separated IPs or
+	// CIDRs). With none configured the socket address is used as is.
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	store, err := middleware.InitSessionStore(database.DB)
 	if err != nil {
 		log.Fatal("Failed to initialize session store:", err)
@@ -26,24 +36,35 @@ func SetupRouter() *gin.Engine {
 		c.JSON(200, gin.H{"message": "Server running", "status": "ok"})
 	})
 
+	// Unauthenticated traffic is limited per IP, everything behind a session
+	// per user
+	authLimit := middleware.RateLimit(middleware.NewRateLimiter(12*time.Second, 5))
+
 	public := r.Group("/api")
+	public.Use(middleware.RateLimit(middleware.NewRateLimiter(time.Second, 30)))
 	{
-		RegisterUserRoutes(public)
+		RegisterUserRoutes(public, authLimit)
 	}
 
 	protected := r.Group("/api")
 	protected.Use(middleware.SessionAuth())
+	protected.Use(middleware.RateLimit(middleware.NewRateLimiter(100*time.Millisecond, 50)))
 	{
 		RegisterChannelRoutes(protected)
 		RegisterMemberRoutes(protected)
 		RegisterMessageRoutes(protected)
+		RegisterInviteRoutes(protected)
+		RegisterDirectMessageRoutes(protected)
+		RegisterAttachmentRoutes(protected)
 
 	}
 
 	ws := r.Group("/ws")
 	ws.Use(middleware.SessionAuth())
+	ws.Use(middleware.RateLimit(middleware.NewRateLimiter(3*time.Second, 10)))
 	{
 		// Chat WebSocket
+		ws.GET("", handlers.MultiplexWebSocket)
 		ws.GET("/:channelId", handlers.ChatWebSocket)
 	}
 
@@ -68,3 +89,13 @@ func SetupRouter() *gin.Engine {
 
 	return r
 }
+
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -6,13 +6,35 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterUserRoutes(rg *gin.RouterGroup) {
+// authLimit guards the credential endpoints, which are what gets brute-forced
+func RegisterUserRoutes(rg *gin.RouterGroup, authLimit gin.HandlerFunc) {
 	user := rg.Group("/user")
 	{
-		user.POST("/register", handlers.RegisterUser)
-		user.POST("/login", handlers.LoginUser)
+		user.POST("/register", authLimit, handlers.RegisterUser)
+		user.POST("/login", authLimit, handlers.LoginUser)
+		user.POST("/login/2fa", authLimit, handlers.VerifyTwoFactorLogin)
+		user.POST("/forgot-password", authLimit, handlers.ForgotPassword)
+		user.POST("/reset-password", authLimit, handlers.ResetPassword)
+		user.POST("/verify-email", authLimit, handlers.VerifyEmail)
+		user.POST("/resend-verification", middleware.SessionAuth(), handlers.ResendVerification)
 
 		user.POST("/logout", middleware.SessionAuth(), handlers.LogoutUser)
 		user.GET("/me", middleware.SessionAuth(), handlers.GetMe)
+		user.GET("/mentions", middleware.SessionAuth(), handlers.ListMentions)
+	}
+
+	twoFactor := user.Group("/2fa", middleware.SessionAuth(), middleware.RequireSession())
+	{
+		twoFactor.POST("/setup", handlers.SetupTwoFactor)
+		twoFactor.POST("/confirm", authLimit, handlers.ConfirmTwoFactor)
+		twoFactor.POST("/disable", authLimit, handlers.DisableTwoFactor)
+		twoFactor.POST("/recovery-codes", authLimit, handlers.RegenerateRecoveryCodes)
+	}
+
+	tokens := user.Group("/tokens", middleware.SessionAuth(), middleware.RequireSession())
+	{
+		tokens.GET("", handlers.ListAPITokens)
+		tokens.POST("", handlers.CreateAPIToken)
+		tokens.DELETE("/:tokenId", handlers.RevokeAPIToken)
 	}
 }
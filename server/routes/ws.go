@@ -6,5 +6,6 @@ import (
 )
 
 func RegisterWebSocketRoutes(rg *gin.RouterGroup) {
+	rg.GET("", handlers.MultiplexWebSocket)
 	rg.GET("/:channelId", handlers.ChatWebSocket)
 }
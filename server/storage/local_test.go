@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// exerciseStorage runs the behaviour every backend has to share
+func exerciseStorage(t *testing.T, store Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	const key = "channel/attachment"
+	const body = "hello, attachment"
+
+	if err := store.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("reading object: %v", err)
+	}
+	if string(got) != body {
+		t.Errorf("Get returned %q, want %q", got, body)
+	}
+
+	// Putting the same key again replaces the object
+	const replaced = "replaced"
+	if err := store.Put(ctx, key, strings.NewReader(replaced), int64(len(replaced)), "text/plain"); err != nil {
+		t.Fatalf("Put over existing key: %v", err)
+	}
+	reader, err = store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get after overwrite: %v", err)
+	}
+	got, _ = io.ReadAll(reader)
+	reader.Close()
+	if string(got) != replaced {
+		t.Errorf("Get after overwrite returned %q, want %q", got, replaced)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+
+	// Deleting twice is fine; the janitor may race a request
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+
+	if _, err := store.Get(ctx, "channel/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	store, err := NewLocalStorage(filepath.Join(t.TempDir(), "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exerciseStorage(t, store)
+}
+
+func TestLocalStorageLeavesNoTempFiles(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(context.Background(), "a/b", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "b" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("directory holds %v, want just [b]", names)
+	}
+}
+
+func TestLocalStorageRejectsEscapingKeys(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "uploads")
+	store, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Something worth stealing just outside the root
+	secret := filepath.Join(parent, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{
+		"",
+		".",
+		"./",
+		"..",
+		"../secret",
+		"a/../../secret",
+		"../uploads/../secret",
+		"/etc/passwd",
+		secret,
+	}
+
+	ctx := context.Background()
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if reader, err := store.Get(ctx, key); err == nil {
+			reader.Close()
+			t.Errorf("Get(%q) succeeded", key)
+		} else if errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) looked the key up instead of rejecting it", key)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+
+	if data, err := os.ReadFile(secret); err != nil || string(data) != "secret" {
+		t.Errorf("file outside the root was touched: %q, %v", data, err)
+	}
+}
+
+func TestLocalStorageAllowsKeysThatStayInside(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cleans to "b/c", still under the root
+	if err := store.Put(context.Background(), "a/../b/c", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b", "c")); err != nil {
+		t.Errorf("object not stored at b/c: %v", err)
+	}
+}
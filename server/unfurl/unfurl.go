@@ -0,0 +1,331 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrBlockedAddress = errors.New("unfurl: address is not publicly routable")
+	ErrNotHTML        = errors.New("unfurl: response is not an HTML page")
+)
+
+const (
+	maxBodySize       = 1 << 20
+	maxRedirects      = 3
+	maxTitleLen       = 300
+	maxDescriptionLen = 500
+	cacheTTL          = 6 * time.Hour
+	failureTTL        = 30 * time.Minute
+	maxCacheEntries   = 5000
+)
+
+// Embed is the preview shown under a message for one URL
+type Embed struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// Fetcher retrieves page metadata. It refuses to connect to loopback,
+// private, link-local and other internal addresses; the check runs on the
+// resolved IP at dial time, so DNS tricks and redirects can't slip past it.
+type Fetcher struct {
+	client *http.Client
+
+	// AllowAddr decides which resolved IPs may be dialled. Tests swap it to
+	// reach an httptest server on loopback.
+	AllowAddr func(netip.Addr) bool
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	embed   *Embed
+	err     error
+	expires time.Time
+}
+
+func NewFetcher() *Fetcher {
+	f := &Fetcher{
+		AllowAddr: IsPublicAddr,
+		cache:     make(map[string]cacheEntry),
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !f.AllowAddr(addr.Unmap()) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	f.client = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			// Never route through an environment proxy; it would do the dialling
+			// and bypass the address check
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 5 * time.Second,
+			MaxIdleConns:          20,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("unfurl: too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unfurl: refusing redirect to %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	return f
+}
+
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublicAddr reports whether addr is safe for the server to connect to
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch returns the preview for rawURL, serving repeats from a short-lived
+// cache. Failures are cached too so a dead link isn't retried on every post.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Embed, error) {
+	if entry, ok := f.cached(rawURL); ok {
+		return entry.embed, entry.err
+	}
+
+	embed, err := f.fetch(ctx, rawURL)
+
+	// A cancelled caller says nothing about the URL itself
+	if ctx.Err() == nil {
+		ttl := cacheTTL
+		if err != nil {
+			ttl = failureTTL
+		}
+		f.store(rawURL, cacheEntry{embed: embed, err: err, expires: time.Now().Add(ttl)})
+	}
+
+	return embed, err
+}
+
+func (f *Fetcher) cached(rawURL string) (cacheEntry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.cache[rawURL]
+	if !ok || time.Now().After(entry.expires) {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (f *Fetcher) store(rawURL string, entry cacheEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.cache) >= maxCacheEntries {
+		now := time.Now()
+		for key, existing := range f.cache {
+			if now.After(existing.expires) {
+				delete(f.cache, key)
+			}
+		}
+		// Still full of live entries; start over rather than grow without bound
+		if len(f.cache) >= maxCacheEntries {
+			clear(f.cache)
+		}
+	}
+	f.cache[rawURL] = entry
+}
+
+func (f *Fetcher) fetch(ctx context.Context, rawURL string) (*Embed, error) {
+	pageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if pageURL.Scheme != "http" && pageURL.Scheme != "https" {
+		return nil, fmt.Errorf("unfurl: unsupported scheme %q", pageURL.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "VyenetBot/1.0 (+link previews)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unfurl: %s returned %d", rawURL, resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	embed := parseMetadata(io.LimitReader(resp.Body, maxBodySize), resp.Request.URL)
+	embed.URL = rawURL
+
+	if embed.Title == "" && embed.Description == "" {
+		return nil, errors.New("unfurl: page has no title or description")
+	}
+	return embed, nil
+}
+
+// parseMetadata reads OpenGraph tags, falling back to <title> and the plain
+// description meta tag. It stops at </head> or the body, whichever comes first.
+func parseMetadata(body io.Reader, base *url.URL) *Embed {
+	var (
+		og        = make(map[string]string)
+		title     string
+		desc      string
+		inTitle   bool
+		tokenizer = html.NewTokenizer(body)
+	)
+
+loop:
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			break loop
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "body":
+				break loop
+			case "title":
+				inTitle = title == ""
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				var key, content string
+				for {
+					attr, value, more := tokenizer.TagAttr()
+					switch strings.ToLower(string(attr)) {
+					case "property", "name":
+						key = strings.ToLower(string(value))
+					case "content":
+						content = string(value)
+					}
+					if !more {
+						break
+					}
+				}
+				if strings.HasPrefix(key, "og:") {
+					if _, seen := og[key]; !seen {
+						og[key] = content
+					}
+				} else if key == "description" && desc == "" {
+					desc = content
+				}
+			}
+
+		case html.TextToken:
+			if inTitle {
+				title += string(tokenizer.Text())
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		}
+	}
+
+	embed := &Embed{
+		Title:       clean(firstNonEmpty(og["og:title"], title), maxTitleLen),
+		Description: clean(firstNonEmpty(og["og:description"], desc), maxDescriptionLen),
+		SiteName:    clean(og["og:site_name"], maxTitleLen),
+	}
+
+	if image := strings.TrimSpace(og["og:image"]); image != "" {
+		if resolved, err := base.Parse(image); err == nil && (resolved.Scheme == "http" || resolved.Scheme == "https") {
+			embed.ImageURL = resolved.String()
+		}
+	}
+
+	return embed
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace and cuts s to at most limit runes
+func clean(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
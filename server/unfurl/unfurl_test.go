@@ -0,0 +1,193 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newTestFetcher returns a fetcher that may dial srv on loopback but still
+// applies the default policy to every other address
+func newTestFetcher(t *testing.T, srv *httptest.Server) *Fetcher {
+	t.Helper()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := netip.MustParseAddr(u.Hostname())
+
+	f := NewFetcher()
+	f.AllowAddr = func(addr netip.Addr) bool {
+		return addr == allowed || IsPublicAddr(addr)
+	}
+	return f
+}
+
+func servePage(contentType, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}
+}
+
+func TestFetchOpenGraph(t *testing.T) {
+	srv := httptest.NewServer(servePage("text/html; charset=utf-8", `<!doctype html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="  The   real title ">
+<meta property="og:description" content="What the page is about">
+<meta property="og:site_name" content="Example">
+<meta property="og:image" content="/images/cover.png">
+<meta property="og:image" content="/images/second.png">
+</head><body><meta property="og:title" content="Ignored"></body></html>`))
+	defer srv.Close()
+
+	embed, err := newTestFetcher(t, srv).Fetch(context.Background(), srv.URL+"/post")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	want := Embed{
+		URL:         srv.URL + "/post",
+		Title:       "The real title",
+		Description: "What the page is about",
+		SiteName:    "Example",
+		ImageURL:    srv.URL + "/images/cover.png",
+	}
+	if *embed != want {
+		t.Errorf("got %+v, want %+v", *embed, want)
+	}
+}
+
+func TestFetchFallsBackToTitle(t *testing.T) {
+	srv := httptest.NewServer(servePage("text/html", `<html><head>
+<title>Plain
+  title</title>
+<meta name="description" content="Plain description">
+<meta property="og:image" content="javascript:alert(1)">
+</head></html>`))
+	defer srv.Close()
+
+	embed, err := newTestFetcher(t, srv).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if embed.Title != "Plain title" {
+		t.Errorf("title = %q, want %q", embed.Title, "Plain title")
+	}
+	if embed.Description != "Plain description" {
+		t.Errorf("description = %q, want %q", embed.Description, "Plain description")
+	}
+	if embed.ImageURL != "" {
+		t.Errorf("image = %q, want none for a non-http URL", embed.ImageURL)
+	}
+}
+
+func TestFetchReadsAtMostOneMegabyte(t *testing.T) {
+	page := func(padding int) string {
+		return "<html><head>" + strings.Repeat(" ", padding) + "<title>Late title</title></head></html>"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/small", servePage("text/html", page(maxBodySize-100)))
+	mux.HandleFunc("/large", servePage("text/html", page(maxBodySize)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := newTestFetcher(t, srv)
+
+	if embed, err := f.Fetch(context.Background(), srv.URL+"/small"); err != nil || embed.Title != "Late title" {
+		t.Fatalf("title just inside the limit: got %+v, %v", embed, err)
+	}
+	if embed, err := f.Fetch(context.Background(), srv.URL+"/large"); err == nil {
+		t.Fatalf("title past the limit was read: got %+v", embed)
+	}
+}
+
+func TestFetchRejectsNonHTML(t *testing.T) {
+	for _, contentType := range []string{"application/json", "image/png", "text/plain", ""} {
+		t.Run(contentType, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Content-Type"] = []string{contentType}
+				w.Write([]byte("<html><head><title>Looks like HTML</title></head></html>"))
+			}))
+			defer srv.Close()
+
+			if _, err := newTestFetcher(t, srv).Fetch(context.Background(), srv.URL); !errors.Is(err, ErrNotHTML) {
+				t.Errorf("err = %v, want %v", err, ErrNotHTML)
+			}
+		})
+	}
+}
+
+func TestFetchRefusesRedirectsToBlockedAddresses(t *testing.T) {
+	targets := []string{
+		"http://127.0.0.2/",
+		"http://10.0.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"http://[::ffff:169.254.169.254]/",
+	}
+
+	for _, target := range targets {
+		t.Run(target, func(t *testing.T) {
+			srv := httptest.NewServer(http.RedirectHandler(target, http.StatusFound))
+			defer srv.Close()
+
+			if _, err := newTestFetcher(t, srv).Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBlockedAddress) {
+				t.Errorf("err = %v, want %v", err, ErrBlockedAddress)
+			}
+		})
+	}
+}
+
+func TestFetchRefusesBlockedAddressesByDefault(t *testing.T) {
+	srv := httptest.NewServer(servePage("text/html", "<title>Internal</title>"))
+	defer srv.Close()
+
+	if _, err := NewFetcher().Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("err = %v, want %v", err, ErrBlockedAddress)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"fc00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"255.255.255.255", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed from RFC 6238 appendix B, "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 SHA-1 test vectors, cut to our six digits
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range rfcVectors {
+		if got := totpCode(key, v.unix/totpPeriod); got != v.code {
+			t.Errorf("totpCode at t=%d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfcVectors {
+		step, ok := ValidateTOTP(rfcSecret, v.code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("t=%d: code %s rejected", v.unix, v.code)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("t=%d: step = %d, want %d", v.unix, step, want)
+		}
+	}
+
+	// Lower case secrets and codes typed with spaces are accepted
+	if _, ok := ValidateTOTP(strings.ToLower(rfcSecret), " 287 082 ", time.Unix(59, 0)); !ok {
+		t.Error("code with spaces against a lower case secret rejected")
+	}
+
+	for _, code := range []string{"", "28708", "2870820", "abcdef", "287083"} {
+		if _, ok := ValidateTOTP(rfcSecret, code, time.Unix(59, 0)); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+
+	if _, ok := ValidateTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("code accepted against an invalid secret")
+	}
+}
+
+func TestValidateTOTPSkewWindow(t *testing.T) {
+	// 1111111109 is step 37037036; its code stays valid one step either side
+	const unix = 1111111109
+	const code = "081804"
+	issued := int64(unix / totpPeriod)
+
+	tests := []struct {
+		name   string
+		offset int64 // in steps
+		ok     bool
+	}{
+		{"two steps early", -2, false},
+		{"one step early", -1, true},
+		{"same step", 0, true},
+		{"one step late", 1, true},
+		{"two steps late", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := time.Unix((issued+tt.offset)*totpPeriod, 0)
+			step, ok := ValidateTOTP(rfcSecret, code, at)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			// The step reported is the one the code was issued for, not the
+			// current one, so replay protection keys on the right value
+			if ok && step != issued {
+				t.Errorf("step = %d, want %d", step, issued)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q doesn't decode: %v", secret, err)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/totpPeriod)
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("freshly generated code %s rejected", code)
+	}
+}
+
+var recoveryCodeFormat = regexp.MustCompile(`^[abcdefghjkmnpqrstuvwxyz23456789]{4}-[abcdefghjkmnpqrstuvwxyz23456789]{4}-[abcdefghjkmnpqrstuvwxyz23456789]{4}$`)
+
+func TestRecoveryCodeRoundTrip(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		code, err := GenerateRecoveryCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !recoveryCodeFormat.MatchString(code) {
+			t.Fatalf("code %q has the wrong format", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+		seen[code] = true
+
+		if got := NormalizeRecoveryCode(code); got != code {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want it unchanged", code, got)
+		}
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+		if got := NormalizeRecoveryCode(typed); got != code {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", typed, got, code)
+		}
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"k7m2-x9qf-p3wd", "k7m2-x9qf-p3wd"},
+		{"K7M2X9QFP3WD", "k7m2-x9qf-p3wd"},
+		{"k7m2 x9qf p3wd", "k7m2-x9qf-p3wd"},
+		{" k7m2--x9qf-p3wd ", "k7m2-x9qf-p3wd"},
+		{"k7m", "k7m"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
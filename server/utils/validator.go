@@ -64,7 +64,7 @@ func ValidateUsername(username string) error {
 	}
 
 	// Check for reserved usernames
-	reserved := []string{"admin", "root", "system", "anonymous"}
+	reserved := []string{"admin", "root", "system", "anonymous", "channel"}
 	if slices.Contains(reserved, strings.ToLower(username)) {
 		return errors.New("This username is reserved")
 	}